@@ -0,0 +1,701 @@
+// Package assembler translates LC4 assembly into programs that can be written
+// as object files for the tokenizer to load.
+//
+// A line holds an optional label, then an instruction, directive or macro
+// call, then an optional comment starting with ';'. Operands are separated by
+// commas or spaces. Immediates are constant expressions of decimal (#-5 or
+// -5) and hex (x1F or 0x1F) numbers, labels and constant names, see eval.
+package assembler
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"github.com/hryoma/lc4go/tokenizer"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSR can only reach addresses aligned to this many words
+const FALIGN_SIZE = 16
+
+const MAX_ERRORS = 20
+
+// how deeply macro calls can nest, which stops macros that call themselves
+const MAX_MACRO_DEPTH = 64
+
+// Program is an assembled or linked object file, along with what only the
+// assembler knows about it
+type Program struct {
+	// Files is the file assembled, followed by the files it includes, and
+	// Symbols does not include .CONST and .UCONST names
+	tokenizer.Program
+	Consts map[string]int
+	// the local labels of macro calls, such as LOOP.2, which are only
+	// meaningful within the file, so they are left out of object files
+	Locals  map[string]bool
+	Listing []*ListingLine
+}
+
+// ListingLine is a source line along with the words it assembled to. Lines
+// expanded from a macro have the file and line number of the macro call.
+type ListingLine struct {
+	File  string
+	Num   int
+	Text  string
+	Macro string
+	Addr  uint16
+	Words []uint16
+	// the resolved value of its label or immediate operand, if any
+	Value string
+
+	// position in the listing, which orders errors
+	pos     int
+	fileIdx int
+	// column of the macro call that an expanded line comes from
+	callCol  int
+	seg      *tokenizer.Segment
+	idx      int
+	reserved bool
+}
+
+// Error is an assembler error at a position in a source file
+type Error struct {
+	File string
+	Line int
+	Col  int
+	Msg  string
+
+	pos int
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", err.File, err.Line, err.Col, err.Msg)
+}
+
+// ErrorList holds every error found in a source file, in order
+type ErrorList []*Error
+
+func (errs ErrorList) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type operand struct {
+	text string
+	col  int
+}
+
+type statement struct {
+	src   *ListingLine
+	op    string
+	opCol int
+	args  []operand
+	addr  uint16
+	seg   *tokenizer.Segment
+	// index of the statement's first word in seg
+	idx int
+}
+
+// macro is a .MACRO definition, with the body lines as they are written
+type macro struct {
+	name   string
+	params []string
+	lines  []string
+	src    *ListingLine
+}
+
+type assembler struct {
+	prog *Program
+	errs ErrorList
+
+	stmts   []*statement
+	consts  map[string]int
+	externs map[string]bool
+	macros  map[string]*macro
+	// the macro being defined, until its .ENDM
+	defining *macro
+	// number of macro calls so far, which makes local labels unique
+	expansions int
+	depth      int
+	// files being read, to catch files that include themselves
+	including []string
+
+	inData bool
+	// location counters of the code and data sections
+	codeLc int
+	dataLc int
+	seg    *tokenizer.Segment
+	// the .ADDR that last set each location counter, where overlaps are
+	// reported, and the last one reported
+	codeAddr   *statement
+	dataAddr   *statement
+	overlapped *statement
+}
+
+// AssembleFile reads and assembles a source file
+func AssembleFile(fileName string) (*Program, error) {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(fileName, src)
+}
+
+// Assemble translates src, read from fileName, into a program. The error is
+// an ErrorList if the source has errors.
+func Assemble(fileName string, src []byte) (*Program, error) {
+	a := &assembler{
+		prog: &Program{
+			Program: tokenizer.Program{Symbols: map[string]uint16{}},
+			Consts:  map[string]int{},
+			Locals:  map[string]bool{},
+		},
+		externs: map[string]bool{},
+		macros:  map[string]*macro{},
+		codeLc:  machine.USER_CODE_START,
+		dataLc:  machine.USER_DATA_START,
+	}
+	a.consts = a.prog.Consts
+
+	a.readFile(fileName, src)
+	if m := a.defining; m != nil {
+		a.errorf(m.src, 1, ".MACRO is missing its .ENDM")
+	}
+	for _, stmt := range a.stmts {
+		a.encode(stmt)
+	}
+	for _, line := range a.prog.Listing {
+		if line.seg != nil {
+			line.Words = line.seg.Words[line.idx : line.idx+len(line.Words)]
+		}
+	}
+
+	if len(a.errs) > 0 {
+		sort.SliceStable(a.errs, func(i, j int) bool {
+			if a.errs[i].pos != a.errs[j].pos {
+				return a.errs[i].pos < a.errs[j].pos
+			}
+			return a.errs[i].Col < a.errs[j].Col
+		})
+		if len(a.errs) > MAX_ERRORS {
+			a.errs = a.errs[:MAX_ERRORS]
+		}
+		return nil, a.errs
+	}
+	return a.prog, nil
+}
+
+// errorf records an error at a column of a source line. Errors in lines
+// expanded from a macro are reported at the macro call.
+func (a *assembler) errorf(src *ListingLine, col int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if src.Macro != "" {
+		col = src.callCol
+		msg = fmt.Sprintf("in macro %s: %s", src.Macro, msg)
+	}
+
+	a.errs = append(a.errs, &Error{
+		File: src.File,
+		Line: src.Num,
+		Col:  col,
+		Msg:  msg,
+		pos:  src.pos,
+	})
+}
+
+// readFile lays out the lines of a source file, or of a file it includes
+func (a *assembler) readFile(fileName string, src []byte) {
+	fileIdx := len(a.prog.Files)
+	for i, name := range a.prog.Files {
+		if name == fileName {
+			fileIdx = i
+		}
+	}
+	if fileIdx == len(a.prog.Files) {
+		a.prog.Files = append(a.prog.Files, fileName)
+	}
+
+	a.including = append(a.including, fileName)
+	for i, text := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+		a.addLine(&ListingLine{
+			File:    fileName,
+			Num:     i + 1,
+			Text:    strings.TrimRight(text, "\r"),
+			fileIdx: fileIdx,
+		})
+	}
+	a.including = a.including[:len(a.including)-1]
+}
+
+// addLine adds a line to the listing and lays it out, or adds it to the
+// macro being defined
+func (a *assembler) addLine(src *ListingLine) {
+	src.pos = len(a.prog.Listing)
+	a.prog.Listing = append(a.prog.Listing, src)
+
+	if a.defining != nil {
+		a.defineMacroLine(src)
+	} else {
+		a.parseLine(src)
+	}
+}
+
+// lex splits a line into tokens, dropping the comment. Spaces separate
+// tokens except around operators and inside parentheses, so an expression
+// such as (W * H) - 1 stays one token, and a quoted string is one token.
+func lex(line string) []operand {
+	tokens := []operand{}
+	// whether a comma came since the last token
+	comma := false
+	for i := 0; i < len(line) && line[i] != ';'; {
+		switch line[i] {
+		case ' ', '\t':
+			i++
+			continue
+		case ',':
+			comma = true
+			i++
+			continue
+		}
+
+		start := i
+		if line[i] == '"' {
+			if end := strings.IndexByte(line[i+1:], '"'); end >= 0 {
+				i += end + 2
+			} else {
+				i = len(line)
+			}
+		} else {
+			for i < len(line) && !strings.ContainsRune(" \t,;", rune(line[i])) {
+				i++
+			}
+		}
+
+		if last := len(tokens) - 1; last >= 0 && !comma && continuesExpr(tokens[last].text, line[start:i]) {
+			tokens[last].text = line[tokens[last].col-1 : i]
+		} else {
+			tokens = append(tokens, operand{text: line[start:i], col: start + 1})
+		}
+		comma = false
+	}
+	return tokens
+}
+
+// continuesExpr reports whether next is part of the same expression as prev
+func continuesExpr(prev string, next string) bool {
+	if strings.Count(prev, "(") > strings.Count(prev, ")") {
+		return true
+	}
+	return strings.ContainsAny(prev[len(prev)-1:], "+-*/%|&^<>~(") ||
+		strings.ContainsAny(next[:1], "*/%|&^<>)") ||
+		next == "+" || next == "-"
+}
+
+func (a *assembler) isOpcode(token string) bool {
+	_, isInsn := mnemonics[strings.ToUpper(token)]
+	_, isMacro := a.macros[strings.ToUpper(token)]
+	return isInsn || isMacro || strings.HasPrefix(token, ".")
+}
+
+// parseLine records a line's label and lays out its instruction, directive
+// or macro call
+func (a *assembler) parseLine(src *ListingLine) {
+	tokens := lex(src.Text)
+	if len(tokens) == 0 {
+		return
+	}
+
+	var label *operand
+	if !a.isOpcode(tokens[0].text) {
+		// without a colon, a label followed by no instruction is more likely
+		// a misspelled instruction
+		if len(tokens) > 1 && !a.isOpcode(tokens[1].text) && !strings.HasSuffix(tokens[0].text, ":") {
+			a.errorf(src, tokens[0].col, "unknown instruction %q", tokens[0].text)
+			return
+		}
+		label = &operand{text: strings.TrimSuffix(tokens[0].text, ":"), col: tokens[0].col}
+		tokens = tokens[1:]
+	}
+
+	if len(tokens) == 0 {
+		a.defineLabel(src, label)
+		return
+	}
+
+	stmt := &statement{
+		src:   src,
+		op:    strings.ToUpper(tokens[0].text),
+		opCol: tokens[0].col,
+		args:  tokens[1:],
+	}
+	if !a.isOpcode(stmt.op) {
+		a.errorf(src, stmt.opCol, "unknown instruction %q", tokens[0].text)
+		return
+	}
+
+	switch stmt.op {
+	case ".CONST", ".UCONST", ".EQU":
+		a.defineConst(stmt, label)
+		return
+	case ".CODE", ".DATA", ".ADDR", ".FALIGN":
+		// labels name the address after the directive takes effect
+		a.layoutDirective(stmt)
+		a.defineLabel(src, label)
+		return
+	case ".MACRO":
+		if label != nil {
+			a.errorf(src, label.col, "write the macro name after .MACRO")
+		}
+		a.startMacro(stmt)
+		return
+	case ".ENDM":
+		a.errorf(src, stmt.opCol, ".ENDM without .MACRO")
+		return
+	case ".INCLUDE":
+		a.defineLabel(src, label)
+		a.include(stmt)
+		return
+	case ".EXTERN":
+		if label != nil {
+			a.errorf(src, label.col, "write the names after .EXTERN")
+		}
+		a.declareExterns(stmt)
+		return
+	}
+
+	a.defineLabel(src, label)
+	if m, isMacro := a.macros[stmt.op]; isMacro {
+		a.expand(stmt, m)
+	} else {
+		a.layout(stmt)
+	}
+}
+
+func (a *assembler) defineLabel(src *ListingLine, label *operand) {
+	if label == nil {
+		return
+	}
+
+	if !isSymbol(label.text) {
+		a.errorf(src, label.col, "invalid label %q", label.text)
+		return
+	} else if a.isDefined(label.text) {
+		a.errorf(src, label.col, "%s is already defined", label.text)
+		return
+	}
+	a.prog.Symbols[label.text] = uint16(a.lc())
+}
+
+func (a *assembler) isDefined(name string) bool {
+	_, isLabel := a.prog.Symbols[name]
+	_, isConst := a.consts[name]
+	return isLabel || isConst || a.externs[name]
+}
+
+// declareExterns declares labels defined in other object files, which the
+// linker fills in
+func (a *assembler) declareExterns(stmt *statement) {
+	if len(stmt.args) == 0 {
+		a.errorf(stmt.src, stmt.opCol, ".EXTERN needs at least one name")
+	}
+	for _, name := range stmt.args {
+		if !isSymbol(name.text) {
+			a.errorf(stmt.src, name.col, "invalid label %q", name.text)
+		} else if a.isDefined(name.text) {
+			a.errorf(stmt.src, name.col, "%s is already defined", name.text)
+		} else {
+			a.externs[name.text] = true
+		}
+	}
+}
+
+// isSymbol reports whether name can be a label or constant name
+func isSymbol(name string) bool {
+	if name == "" || ('0' <= name[0] && name[0] <= '9') || name[0] == '.' || isRegister(name) {
+		return false
+	}
+	for _, char := range name {
+		if char != '_' && char != '.' && !('0' <= char && char <= '9') && !('a' <= char && char <= 'z') && !('A' <= char && char <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isRegister(name string) bool {
+	return len(name) == 2 && (name[0] == 'R' || name[0] == 'r') && '0' <= name[1] && name[1] < '0'+machine.NUM_REGS
+}
+
+// defineConst defines a .CONST, .UCONST or .EQU name. .EQU takes any value
+// that fits in a word, signed or not.
+func (a *assembler) defineConst(stmt *statement, label *operand) {
+	if label == nil {
+		a.errorf(stmt.src, stmt.opCol, "%s needs a name", stmt.op)
+		return
+	} else if !a.checkArgs(stmt, 1) {
+		return
+	}
+
+	val, err := a.constValue(stmt.args[0].text)
+	if err != nil {
+		a.errorf(stmt.src, stmt.args[0].col, "%s", err)
+		return
+	}
+
+	if stmt.op == ".UCONST" && (val < 0 || val > 0xFFFF) {
+		a.errorf(stmt.src, stmt.args[0].col, "%d is out of range for .UCONST (0 to 65535)", val)
+		return
+	} else if stmt.op == ".CONST" && (val < -0x8000 || val > 0x7FFF) {
+		a.errorf(stmt.src, stmt.args[0].col, "%d is out of range for .CONST (-32768 to 32767)", val)
+		return
+	} else if stmt.op == ".EQU" && (val < -0x8000 || val > 0xFFFF) {
+		a.errorf(stmt.src, stmt.args[0].col, "%d is out of range for .EQU (-32768 to 65535)", val)
+		return
+	}
+
+	if !isSymbol(label.text) {
+		a.errorf(stmt.src, label.col, "invalid constant name %q", label.text)
+	} else if a.isDefined(label.text) {
+		a.errorf(stmt.src, label.col, "%s is already defined", label.text)
+	} else {
+		a.consts[label.text] = val
+	}
+}
+
+func (a *assembler) checkArgs(stmt *statement, count int) bool {
+	if len(stmt.args) != count {
+		a.errorf(stmt.src, stmt.opCol, "%s takes %d operands, but got %d", stmt.op, count, len(stmt.args))
+		return false
+	}
+	return true
+}
+
+// include lays out the lines of a file named by .INCLUDE, relative to the
+// directory of the file including it
+func (a *assembler) include(stmt *statement) {
+	if !a.checkArgs(stmt, 1) {
+		return
+	}
+
+	arg := stmt.args[0]
+	if len(arg.text) < 2 || arg.text[0] != '"' || arg.text[len(arg.text)-1] != '"' {
+		a.errorf(stmt.src, arg.col, ".INCLUDE takes a quoted file name, but got %s", arg.text)
+		return
+	}
+	fileName := arg.text[1 : len(arg.text)-1]
+	if !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(filepath.Dir(stmt.src.File), fileName)
+	}
+
+	for _, name := range a.including {
+		if name == fileName {
+			a.errorf(stmt.src, arg.col, "%s includes itself", fileName)
+			return
+		}
+	}
+
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		a.errorf(stmt.src, arg.col, "%s", err)
+		return
+	}
+	a.readFile(fileName, src)
+}
+
+// lc returns the location counter of the current section
+func (a *assembler) lc() int {
+	if a.inData {
+		return a.dataLc
+	}
+	return a.codeLc
+}
+
+func (a *assembler) setLc(lc int) {
+	if a.inData {
+		a.dataLc = lc
+	} else {
+		a.codeLc = lc
+	}
+}
+
+func (a *assembler) layoutDirective(stmt *statement) {
+	switch stmt.op {
+	case ".CODE", ".DATA":
+		if a.checkArgs(stmt, 0) {
+			a.inData = stmt.op == ".DATA"
+		}
+	case ".ADDR":
+		if !a.checkArgs(stmt, 1) {
+			return
+		}
+		addr, err := a.constValue(stmt.args[0].text)
+		if err != nil {
+			a.errorf(stmt.src, stmt.args[0].col, "%s", err)
+		} else if addr < 0 || addr > 0xFFFF {
+			a.errorf(stmt.src, stmt.args[0].col, "address %d is out of range", addr)
+		} else {
+			a.setLc(addr)
+			if a.inData {
+				a.dataAddr = stmt
+			} else {
+				a.codeAddr = stmt
+			}
+		}
+	case ".FALIGN":
+		if a.checkArgs(stmt, 0) {
+			if pad := (FALIGN_SIZE - a.lc()%FALIGN_SIZE) % FALIGN_SIZE; pad > 0 {
+				a.emit(stmt, pad)
+				stmt.src.reserved = true
+			}
+		}
+	}
+}
+
+// layout reserves the words of an instruction or data directive, to be
+// filled in by encode
+func (a *assembler) layout(stmt *statement) {
+	switch stmt.op {
+	case ".FILL":
+		if a.checkArgs(stmt, 1) {
+			a.place(stmt, 1)
+		}
+	case ".BLKW":
+		if !a.checkArgs(stmt, 1) {
+			return
+		}
+		count, err := a.constValue(stmt.args[0].text)
+		if err != nil {
+			a.errorf(stmt.src, stmt.args[0].col, "%s", err)
+		} else if count < 0 {
+			a.errorf(stmt.src, stmt.args[0].col, "negative .BLKW size %d", count)
+		} else if count > 0 {
+			a.emit(stmt, count)
+			stmt.src.reserved = true
+		}
+	default:
+		if strings.HasPrefix(stmt.op, ".") {
+			a.errorf(stmt.src, stmt.opCol, "unknown directive %s", stmt.op)
+			return
+		}
+		if a.inData {
+			a.errorf(stmt.src, stmt.opCol, "instruction %s in a .DATA section", stmt.op)
+			return
+		}
+		a.place(stmt, mnemonics[stmt.op].size)
+	}
+}
+
+// place reserves words for a statement that encode fills in
+func (a *assembler) place(stmt *statement, size int) {
+	stmt.addr = uint16(a.lc())
+	if seg, idx, ok := a.emit(stmt, size); ok {
+		stmt.seg, stmt.idx = seg, idx
+		a.prog.Lines = append(a.prog.Lines, tokenizer.Line{
+			Addr:    stmt.addr,
+			Line:    uint16(stmt.src.Num),
+			FileIdx: uint16(stmt.src.fileIdx),
+			Offset:  -1,
+		})
+		a.stmts = append(a.stmts, stmt)
+	}
+}
+
+// emit reserves size zeroed words at the location counter, starting a new
+// segment unless they follow on from the last one
+func (a *assembler) emit(stmt *statement, size int) (seg *tokenizer.Segment, idx int, ok bool) {
+	lc := a.lc()
+	if lc+size > machine.MEM_SIZE {
+		a.errorf(stmt.src, stmt.opCol, "%s runs past the end of memory", stmt.op)
+		return nil, 0, false
+	}
+	a.checkOverlap(stmt, lc, size)
+
+	seg = a.seg
+	if seg == nil || seg.Data != a.inData || int(seg.Addr)+len(seg.Words) != lc {
+		// an assembled block has no record offset
+		seg = &tokenizer.Segment{Data: a.inData, Addr: uint16(lc), Offset: -1}
+		a.prog.Segments = append(a.prog.Segments, seg)
+		a.seg = seg
+	}
+
+	idx = len(seg.Words)
+	seg.Words = append(seg.Words, make([]uint16, size)...)
+	a.setLc(lc + size)
+
+	// the words are filled in once encoding is done
+	stmt.src.Addr = uint16(lc)
+	stmt.src.Words = make([]uint16, size)
+	stmt.src.seg, stmt.src.idx = seg, idx
+	return seg, idx, true
+}
+
+// checkOverlap reports words placed over ones already placed, at the .ADDR
+// that moved the location counter back over them, or at the statement itself
+// if the location counter ran into them
+func (a *assembler) checkOverlap(stmt *statement, lc int, size int) {
+	for _, seg := range a.prog.Segments {
+		start, end := int(seg.Addr), int(seg.Addr)+len(seg.Words)
+		if lc >= end || start >= lc+size {
+			continue
+		}
+
+		at := a.codeAddr
+		if a.inData {
+			at = a.dataAddr
+		}
+		if at != nil && at == a.overlapped {
+			return
+		} else if at == nil {
+			at = stmt
+		}
+		a.overlapped = at
+		a.errorf(at.src, at.opCol, "x%04X is already in use by x%04X-x%04X", lc, start, end-1)
+		return
+	}
+}
+
+// parseNumber reads a decimal (#10, 10, #-10) or hex (x1F, 0x1F) literal
+func parseNumber(text string) (int, error) {
+	str := strings.TrimPrefix(text, "#")
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	base := 10
+	if strings.HasPrefix(str, "x") || strings.HasPrefix(str, "X") {
+		str, base = str[1:], 16
+	} else if strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X") {
+		str, base = str[2:], 16
+	}
+	if str == "" || (base == 10 && text[0] != '#' && !('0' <= str[0] && str[0] <= '9')) {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+
+	val, err := strconv.ParseInt(str, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	if neg {
+		val = -val
+	}
+	return int(val), nil
+}
+
+// constValue evaluates an expression of numbers, constants and labels
+// defined earlier, for directives that lay out memory
+func (a *assembler) constValue(text string) (int, error) {
+	val, _, err := a.eval(text)
+	return val, err
+}
+
+// value evaluates an operand. isLabel reports whether it is an address, such
+// as a label or LOOP+2, which some instructions treat differently.
+func (a *assembler) value(arg operand) (val int, isLabel bool, err error) {
+	val, addrs, err := a.eval(arg.text)
+	return val, addrs == 1, err
+}
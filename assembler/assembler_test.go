@@ -0,0 +1,480 @@
+package assembler
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"github.com/hryoma/lc4go/tokenizer"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func assemble(t *testing.T, src string) *Program {
+	prog, err := Assemble("test.asm", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestEveryInstruction(t *testing.T) {
+	// each line disassembles back to itself
+	insns := []string{
+		"NOP",
+		"BRp #-1", "BRz #2", "BRzp #3", "BRn #4", "BRnp #5", "BRnz #6", "BRnzp #-256",
+		"ADD R1, R2, R3", "MUL R4, R5, R6", "SUB R7, R0, R1", "DIV R2, R3, R4",
+		"ADD R1, R2, #-16", "AND R3, R4, #15",
+		"CMP R1, R2", "CMPU R3, R4", "CMPI R5, #-64", "CMPIU R6, #127",
+		"JSRR R5", "JSR #-1024",
+		"AND R1, R2, R3", "NOT R4, R5", "OR R6, R7, R0", "XOR R1, R2, R3",
+		"LDR R1, R6, #-32", "STR R7, R6, #31",
+		"RTI",
+		"CONST R3, #-256", "HICONST R3, #255",
+		"SLL R1, R2, #15", "SRA R3, R4, #1", "SRL R5, R6, #0", "MOD R7, R0, R1",
+		"JMPR R7", "JMP #1023",
+		"TRAP x25",
+	}
+	prog := assemble(t, strings.Join(insns, "\n"))
+
+	words := prog.Segments[0].Words
+	if len(words) != len(insns) {
+		t.Fatal("Expected", len(insns), "words but got", len(words))
+	}
+	for i, insn := range insns {
+		machine.Lc4.Mem[0] = words[i]
+		if actual := machine.Decode(0).Asm(); actual != insn {
+			t.Errorf("Expected %s but got %s (x%04X)", insn, actual, words[i])
+		}
+	}
+}
+
+func TestLabelsAndDirectives(t *testing.T) {
+	prog := assemble(t, `
+; comments and blank lines are skipped
+COUNT .CONST #3
+BIG   .UCONST xBEEF
+	.CODE
+	.ADDR x0010
+MAIN	LEA R0, ARRAY
+	LC R1, BIG
+	JSR HELPER
+LOOP:	ADD R1, R1, #-1
+	BRp LOOP
+	TRAP xFF
+	.FALIGN
+HELPER	CONST R2, COUNT
+	RET
+
+	.DATA
+ARRAY	.FILL #-1
+	.FILL MAIN
+	.BLKW 2
+END	.FILL x1234
+`)
+
+	expectedSymbols := map[string]uint16{
+		"MAIN": 0x0010, "LOOP": 0x0015, "HELPER": 0x0020, "ARRAY": 0x2000, "END": 0x2004,
+	}
+	for name, addr := range expectedSymbols {
+		if prog.Symbols[name] != addr {
+			t.Errorf("Expected %s at x%04X but got x%04X", name, addr, prog.Symbols[name])
+		}
+	}
+	if len(prog.Symbols) != len(expectedSymbols) {
+		t.Error("Expected only labels in the symbol table but got", prog.Symbols)
+	}
+
+	expected := []struct {
+		data  bool
+		addr  uint16
+		words []uint16
+	}{
+		{false, 0x0010, []uint16{
+			0x9000, 0xD120, // LEA R0, ARRAY
+			0x92EF, 0xD3BE, // LC R1, BIG
+			0x4802,                 // JSR HELPER
+			0x127F,                 // ADD R1, R1, #-1
+			0x03FE,                 // BRp LOOP
+			0xF0FF,                 // TRAP xFF
+			0, 0, 0, 0, 0, 0, 0, 0, // .FALIGN
+			0x9403, // CONST R2, COUNT
+			0xC1C0, // RET
+		}},
+		{true, 0x2000, []uint16{0xFFFF, 0x0010, 0, 0, 0x1234}},
+	}
+	if len(prog.Segments) != len(expected) {
+		t.Fatal("Expected", len(expected), "segments but got", len(prog.Segments))
+	}
+	for i, seg := range prog.Segments {
+		if seg.Data != expected[i].data || seg.Addr != expected[i].addr {
+			t.Errorf("Segment %d: expected data %t at x%04X but got %t at x%04X", i, expected[i].data, expected[i].addr, seg.Data, seg.Addr)
+		}
+		for j, val := range expected[i].words {
+			if j >= len(seg.Words) || seg.Words[j] != val {
+				t.Errorf("Segment %d: expected %04X at word %d but got %04X", i, expected[i].words, j, seg.Words)
+				break
+			}
+		}
+	}
+
+	// LEA's words both come from line 7, and the .FALIGN padding has no line
+	expectedLines := map[uint16]uint16{0x0010: 7, 0x0011: 0, 0x0018: 0, 0x0020: 14}
+	for addr, num := range expectedLines {
+		if line, _ := prog.LineAt(addr); line.Line != num {
+			t.Errorf("Expected line %d at x%04X but got %d", num, addr, line.Line)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := Assemble("bad.asm", []byte(`
+	ADD R1, R2, #16
+	FOO R1
+	BRz NOWHERE
+	.DATA
+	ADD R1, R1, R1
+	.CODE
+L	NOP
+L	NOP
+	JSR L
+	LDR R1, R8, #0
+	CONST R1
+`))
+
+	expected := []string{
+		"bad.asm:2:14: 16 is out of range for IMM5 (-16 to 15)",
+		"bad.asm:3:2: unknown instruction \"FOO\"",
+		"bad.asm:4:6: undefined symbol NOWHERE",
+		"bad.asm:6:2: instruction ADD in a .DATA section",
+		"bad.asm:9:1: L is already defined",
+		"bad.asm:10:6: JSR target L at x0002 is not aligned, use .FALIGN",
+		"bad.asm:11:10: expected a register but got \"R8\"",
+		"bad.asm:12:2: CONST takes 2 operands, but got 1",
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatal("Expected an ErrorList but got", err)
+	}
+	if len(errs) != len(expected) {
+		t.Error("Expected", len(expected), "errors but got", errs)
+	}
+	for i := 0; i < len(errs) && i < len(expected); i++ {
+		if errs[i].Error() != expected[i] {
+			t.Error("Expected", expected[i], "but got", errs[i])
+		}
+	}
+}
+
+func TestOverlappingSections(t *testing.T) {
+	_, err := Assemble("bad.asm", []byte(`
+	.ADDR x0000
+	NOP
+	NOP
+	.ADDR x0001
+	ADD R1, R1, R1
+	ADD R1, R1, R1
+	.DATA
+	.ADDR x4000
+	.BLKW 2
+	.CODE
+	.ADDR x4001
+	NOP
+`))
+
+	expected := []string{
+		"bad.asm:5:2: x0001 is already in use by x0000-x0001",
+		"bad.asm:12:2: x4001 is already in use by x4000-x4001",
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Error("Expected", expected, "but got", err)
+	}
+
+	// sections that only touch are fine
+	assemble(t, "\t.ADDR x0002\n\tNOP\n\t.ADDR x0000\n\tNOP\n\tNOP")
+}
+
+func TestMacros(t *testing.T) {
+	prog := assemble(t, `
+	.MACRO PUSH reg
+	ADD R6, R6, #-1
+	STR reg, R6, #0
+	.ENDM
+	.MACRO COUNTDOWN reg, n
+	CONST reg, #n
+@LOOP	ADD reg, reg, #-1
+	BRp @LOOP
+	.ENDM
+MAIN	push R7
+	COUNTDOWN R1, 3
+	COUNTDOWN R2, 4
+`)
+
+	expected := []uint16{0x1DBF, 0x7F80, 0x9203, 0x127F, 0x03FE, 0x9404, 0x14BF, 0x03FE}
+	words := prog.Segments[0].Words
+	if len(words) != len(expected) {
+		t.Fatal("Expected", len(expected), "words but got", words)
+	}
+	for i := range expected {
+		if words[i] != expected[i] {
+			t.Errorf("Expected x%04X at %d but got x%04X", expected[i], i, words[i])
+		}
+	}
+
+	// each call gets its own local labels
+	if prog.Symbols["MAIN"] != 0 || prog.Symbols["LOOP.2"] != 3 || prog.Symbols["LOOP.3"] != 6 {
+		t.Error("Unexpected symbols", prog.Symbols)
+	}
+	// expanded words have the line of the call
+	for addr, num := range map[uint16]uint16{0: 11, 4: 12, 7: 13} {
+		if line, _ := prog.LineAt(addr); line.Line != num {
+			t.Errorf("Expected line %d at x%04X but got %d", num, addr, line.Line)
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	prog := assemble(t, `
+W	.EQU 8
+H	.EQU W - 3
+	CONST R1, (W * H) - 1
+	CONST R2, x80 | 3
+	CONST R3, #-(1 << 4)
+	LEA R4, TABLE+2
+	LDR R5, R4, END - TABLE
+BACK	BRz BACK - 1
+	.DATA
+TABLE	.BLKW W / 2
+END	.FILL ~0
+`)
+
+	expected := []uint16{0x9227, 0x9483, 0x97F0, 0x9802, 0xD920, 0x6B04, 0x05FE}
+	words := prog.Segments[0].Words
+	for i := range expected {
+		if words[i] != expected[i] {
+			t.Errorf("Expected x%04X at %d but got x%04X", expected[i], i, words[i])
+		}
+	}
+	if prog.Consts["H"] != 5 || prog.Symbols["END"] != 0x2004 {
+		t.Error("Unexpected symbols", prog.Consts, prog.Symbols)
+	}
+	if data := prog.Segments[1].Words; data[4] != 0xFFFF {
+		t.Errorf("Expected xFFFF but got x%04X", data[4])
+	}
+
+	_, err := Assemble("bad.asm", []byte("\tCONST R2, 1<<70\n\tCONST R2, 4>>-1\n\tBRz FAR\n\t.ADDR x0200\nFAR\tNOP\n"))
+	errs := []string{
+		"bad.asm:1:12: shift count 70 is out of range (0 to 15) in 1<<70",
+		"bad.asm:2:12: shift count -1 is out of range (0 to 15) in 4>>-1",
+		"bad.asm:3:6: offset to FAR (x0200) is 509, out of range for IMM9 (-256 to 255)",
+	}
+	if err == nil || err.Error() != strings.Join(errs, "\n") {
+		t.Error("Expected", errs, "but got", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	lib := "ONE\t.EQU 1\n\t.MACRO INC reg\n\tADD reg, reg, #ONE\n\t.ENDM\n"
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "inc.asm"), []byte(lib), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main.asm")
+	if err := os.WriteFile(main, []byte("\t.INCLUDE \"lib/inc.asm\"\n\tINC R1\n\t.FILL ONE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prog, err := AssembleFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := prog.Segments[0].Words; len(words) != 2 || words[0] != 0x1261 || words[1] != 1 {
+		t.Error("Unexpected words", words)
+	}
+	if len(prog.Files) != 2 || prog.Files[0] != main || prog.Files[1] != filepath.Join(dir, "lib", "inc.asm") {
+		t.Error("Unexpected files", prog.Files)
+	}
+	if line, ok := prog.LineAt(0); !ok || line.Line != 2 || line.FileIdx != 0 {
+		t.Error("Unexpected line info", prog.Lines)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	_, err := Assemble("bad.asm", []byte(`BIG	.EQU 20
+	.MACRO TWICE reg
+	ADD reg, reg, #BIG
+	.ENDM
+	TWICE R1
+	TWICE R1, R2
+	.INCLUDE "bad.asm"
+	ADD R1, R1, #(BIG - 4)
+	.MACRO ADD x
+	.ENDM
+	.ENDM
+	.MACRO OPEN`))
+
+	expected := []string{
+		"bad.asm:5:2: in macro TWICE: #BIG = 20 is out of range for IMM5 (-16 to 15)",
+		"bad.asm:6:2: TWICE takes 1 operands, but got 2",
+		"bad.asm:7:11: bad.asm includes itself",
+		"bad.asm:8:14: #(BIG - 4) = 16 is out of range for IMM5 (-16 to 15)",
+		"bad.asm:9:9: ADD is already an instruction",
+		"bad.asm:11:2: .ENDM without .MACRO",
+		"bad.asm:12:1: .MACRO is missing its .ENDM",
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatal("Expected an ErrorList but got", err)
+	}
+	if len(errs) != len(expected) {
+		t.Error("Expected", len(expected), "errors but got", errs)
+	}
+	for i := 0; i < len(errs) && i < len(expected); i++ {
+		if errs[i].Error() != expected[i] {
+			t.Error("Expected", expected[i], "but got", errs[i])
+		}
+	}
+}
+
+func TestWriteObjLoads(t *testing.T) {
+	prog := assemble(t, `
+	.CODE
+	.ADDR x0000
+MAIN	CONST R0, #5
+	TRAP xFF
+	.DATA
+	.ADDR x4000
+VALUE	.FILL x00AB
+`)
+
+	fileName := filepath.Join(t.TempDir(), "test.obj")
+	if err := prog.WriteObjFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	machine.Lc4.Mem = [machine.MEM_SIZE]uint16{}
+	machine.Lc4.Labels = map[string]uint16{}
+	machine.Lc4.Meta = map[uint16]machine.MemMetadata{}
+	machine.Lc4.Files = nil
+	tokenizer.TokenizeObj(fileName)
+
+	if machine.Lc4.Mem[0x0000] != 0x9005 || machine.Lc4.Mem[0x0001] != 0xF0FF || machine.Lc4.Mem[0x4000] != 0x00AB {
+		t.Errorf("Unexpected memory x%04X x%04X x%04X", machine.Lc4.Mem[0x0000], machine.Lc4.Mem[0x0001], machine.Lc4.Mem[0x4000])
+	}
+	if machine.Lc4.Labels["MAIN"] != 0x0000 || machine.Lc4.Labels["VALUE"] != 0x4000 {
+		t.Error("Unexpected labels", machine.Lc4.Labels)
+	}
+	if meta := machine.Lc4.Meta[0x0001]; meta.Line != 5 || machine.Lc4.Files[meta.File] != "test.asm" {
+		t.Error("Unexpected line info", meta, machine.Lc4.Files)
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	prog := assemble(t, `COUNT .CONST #3
+	.ADDR x0010
+MAIN	LEA R0, ARRAY
+LOOP	ADD R1, R1, #-1
+	BRp LOOP
+	TRAP x25
+	.DATA
+ARRAY	.BLKW COUNT`)
+
+	var out strings.Builder
+	if err := prog.WriteListing(&out); err != nil {
+		t.Fatal(err)
+	}
+	listing := out.String()
+
+	expected := []string{
+		"    3  x0010  x9000  1001000000000000  ARRAY = x2000                 MAIN\tLEA R0, ARRAY\n",
+		"       x0011  xD120  1101000100100000\n",
+		"    4  x0012  x127F  0001001001111111  #-1                           LOOP\tADD R1, R1, #-1\n",
+		"    5  x0013  x03FE  0000001111111110  LOOP = x0012, offset #-2      \tBRp LOOP\n",
+		"    6  x0014  xF025  1111000000100101  #37                           \tTRAP x25\n",
+		"    8  x2000         (3 words)                                       ARRAY\t.BLKW COUNT\n",
+		"x0012  LOOP\n",
+		"x2000  ARRAY\n",
+		"x0003  COUNT = #3\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(listing, line) {
+			t.Errorf("Expected listing to contain %q but got\n%s", line, listing)
+		}
+	}
+}
+
+func TestExterns(t *testing.T) {
+	prog := assemble(t, `
+	.EXTERN PRINT, TABLE
+	LEA R0, TABLE+2
+	JSR PRINT
+	BRz PRINT
+	.FILL TABLE`)
+
+	expected := []tokenizer.Reloc{
+		{Addr: 0, Kind: tokenizer.RELOC_LO8, Symbol: "TABLE", Offset: 2, RecordOffset: -1},
+		{Addr: 1, Kind: tokenizer.RELOC_HI8, Symbol: "TABLE", Offset: 2, RecordOffset: -1},
+		{Addr: 2, Kind: tokenizer.RELOC_JSR, Symbol: "PRINT", RecordOffset: -1},
+		{Addr: 3, Kind: tokenizer.RELOC_PC9, Symbol: "PRINT", RecordOffset: -1},
+		{Addr: 4, Kind: tokenizer.RELOC_WORD, Symbol: "TABLE", RecordOffset: -1},
+	}
+	if len(prog.Relocs) != len(expected) {
+		t.Fatal("Expected", expected, "but got", prog.Relocs)
+	}
+	for i := range expected {
+		if prog.Relocs[i] != expected[i] {
+			t.Error("Expected", expected[i], "but got", prog.Relocs[i])
+		}
+	}
+
+	_, err := Assemble("bad.asm", []byte("\t.EXTERN X\n\tADD R1, R1, X\n\tLEA R1, X*2\n"))
+	errs := []string{
+		"bad.asm:2:14: X is external, and can only be used as an address",
+		"bad.asm:3:10: external symbol X can only be offset by a constant",
+	}
+	if err == nil || err.Error() != strings.Join(errs, "\n") {
+		t.Error("Expected", errs, "but got", err)
+	}
+}
+
+func TestReadObj(t *testing.T) {
+	prog := assemble(t, `
+	.EXTERN PRINT
+MAIN	JSR PRINT
+	.DATA
+VALUE	.FILL x00AB`)
+
+	var buf strings.Builder
+	if err := prog.WriteObj(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadObj(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.Segments) != 2 || read.Segments[1].Addr != machine.USER_DATA_START || read.Segments[1].Words[0] != 0x00AB {
+		t.Error("Unexpected segments", read.Segments)
+	}
+	if read.Symbols["MAIN"] != 0 || read.Symbols["VALUE"] != machine.USER_DATA_START {
+		t.Error("Unexpected symbols", read.Symbols)
+	}
+	if line, _ := read.LineAt(0); len(read.Files) != 1 || read.Files[0] != "test.asm" || line.Line != 3 {
+		t.Error("Unexpected line info", read.Files, read.Lines)
+	}
+	if len(read.Relocs) != 1 {
+		t.Fatal("Expected", prog.Relocs, "but got", read.Relocs)
+	}
+	// the read relocation also has the offset of its record
+	reloc := read.Relocs[0]
+	reloc.RecordOffset = -1
+	if reloc != prog.Relocs[0] || read.Relocs[0].RecordOffset <= 0 {
+		t.Error("Expected", prog.Relocs, "but got", read.Relocs)
+	}
+
+	if _, err := ReadObj(strings.NewReader(buf.String()[:5])); err == nil {
+		t.Error("Expected an error for a truncated object")
+	}
+}
@@ -0,0 +1,407 @@
+package assembler
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"github.com/hryoma/lc4go/tokenizer"
+	"strings"
+)
+
+type mnemonic struct {
+	op machine.Op
+	// number of words it assembles to
+	size int
+}
+
+var mnemonics = map[string]mnemonic{}
+
+func init() {
+	for op := machine.OpNOP; op <= machine.OpLC; op++ {
+		switch op {
+		case machine.OpADDI, machine.OpANDI:
+			// written as ADD and AND with an immediate
+			continue
+		case machine.OpLEA, machine.OpLC:
+			mnemonics[strings.ToUpper(op.String())] = mnemonic{op: op, size: 2}
+		default:
+			mnemonics[strings.ToUpper(op.String())] = mnemonic{op: op, size: 1}
+		}
+	}
+	mnemonics["BR"] = mnemonic{op: machine.OpBRnzp, size: 1}
+}
+
+// immediate field formats, with their ranges
+type immFormat struct {
+	name string
+	bits uint
+	min  int
+	max  int
+}
+
+var (
+	IMM5   = immFormat{"IMM5", 5, -16, 15}
+	IMM6   = immFormat{"IMM6", 6, -32, 31}
+	IMM7   = immFormat{"IMM7", 7, -64, 63}
+	IMM9   = immFormat{"IMM9", 9, -256, 255}
+	IMM11  = immFormat{"IMM11", 11, -1024, 1023}
+	UIMM4  = immFormat{"UIMM4", 4, 0, 15}
+	UIMM7  = immFormat{"UIMM7", 7, 0, 127}
+	UIMM8  = immFormat{"UIMM8", 8, 0, 255}
+	WORD16 = immFormat{"a word", 16, -0x8000, 0xFFFF}
+)
+
+// encoder fills in the words of one statement, keeping the first error
+type encoder struct {
+	a    *assembler
+	stmt *statement
+	err  bool
+}
+
+func (e *encoder) errorf(col int, format string, args ...interface{}) {
+	if !e.err {
+		e.a.errorf(e.stmt.src, col, format, args...)
+		e.err = true
+	}
+}
+
+func (e *encoder) reg(n int) uint16 {
+	if n >= len(e.stmt.args) {
+		return 0
+	}
+
+	arg := e.stmt.args[n]
+	if !isRegister(arg.text) {
+		e.errorf(arg.col, "expected a register but got %q", arg.text)
+		return 0
+	}
+	return uint16(arg.text[1] - '0')
+}
+
+// fits range checks val and returns its low bits
+func (e *encoder) fits(arg operand, val int, format immFormat) uint16 {
+	if val < format.min || val > format.max {
+		if _, err := parseNumber(arg.text); err != nil {
+			// say what the expression or name came to
+			e.errorf(arg.col, "%s = %d is out of range for %s (%d to %d)", arg.text, val, format.name, format.min, format.max)
+		} else {
+			e.errorf(arg.col, "%d is out of range for %s (%d to %d)", val, format.name, format.min, format.max)
+		}
+		return 0
+	}
+	return uint16(val) & (1<<format.bits - 1)
+}
+
+// imm reads an immediate operand
+func (e *encoder) imm(n int, format immFormat) uint16 {
+	if n >= len(e.stmt.args) {
+		return 0
+	}
+
+	arg := e.stmt.args[n]
+	val, isLabel, err := e.a.value(arg)
+	if err != nil {
+		e.errorf(arg.col, "%s", err)
+		return 0
+	}
+	e.describe(arg, val, isLabel)
+	return e.fits(arg, val, format)
+}
+
+// reloc records a relocation for the word at offset from the statement if
+// operand n refers to an .EXTERN symbol, leaving the operand's bits 0
+func (e *encoder) reloc(n int, offset int, kind uint16) bool {
+	if n >= len(e.stmt.args) {
+		return false
+	}
+
+	arg := e.stmt.args[n]
+	sym, symOffset, err := e.a.external(arg.text)
+	if err != nil || sym == "" {
+		// anything else is read, and any error reported, as usual
+		return false
+	}
+
+	e.a.prog.Relocs = append(e.a.prog.Relocs, tokenizer.Reloc{
+		Addr:         e.stmt.addr + uint16(offset),
+		Kind:         kind,
+		Offset:       int16(symOffset),
+		Symbol:       sym,
+		RecordOffset: -1,
+	})
+	e.listing().Value = fmt.Sprintf("%s = external", arg.text)
+	return true
+}
+
+// pcOffset reads the target of a branch or JMP, as a label or an offset
+func (e *encoder) pcOffset(n int, format immFormat) uint16 {
+	if n >= len(e.stmt.args) {
+		return 0
+	}
+
+	kind := uint16(tokenizer.RELOC_PC9)
+	if format == IMM11 {
+		kind = tokenizer.RELOC_PC11
+	}
+	if e.reloc(n, 0, kind) {
+		return 0
+	}
+
+	arg := e.stmt.args[n]
+	val, isLabel, err := e.a.value(arg)
+	if err != nil {
+		e.errorf(arg.col, "%s", err)
+		return 0
+	}
+	e.describe(arg, val, isLabel)
+	if isLabel {
+		target := val
+		val -= int(e.stmt.addr) + 1
+		e.listing().Value += fmt.Sprintf(", offset #%d", val)
+		if val < format.min || val > format.max {
+			e.errorf(arg.col, "offset to %s (x%04X) is %d, out of range for %s (%d to %d)",
+				arg.text, uint16(target), val, format.name, format.min, format.max)
+			return 0
+		}
+	}
+	return e.fits(arg, val, format)
+}
+
+// jsrTarget reads the target of a JSR, as a label or an IMM11
+func (e *encoder) jsrTarget(n int) uint16 {
+	if n >= len(e.stmt.args) || e.reloc(n, 0, tokenizer.RELOC_JSR) {
+		return 0
+	}
+
+	arg := e.stmt.args[n]
+	val, isLabel, err := e.a.value(arg)
+	if err != nil {
+		e.errorf(arg.col, "%s", err)
+		return 0
+	}
+	e.describe(arg, val, isLabel)
+	if !isLabel {
+		return e.fits(arg, val, IMM11)
+	}
+
+	if val%FALIGN_SIZE != 0 {
+		e.errorf(arg.col, "JSR target %s at x%04X is not aligned, use .FALIGN", arg.text, val)
+		return 0
+	} else if uint16(val)&0x8000 != e.stmt.addr&0x8000 {
+		e.errorf(arg.col, "JSR target %s at x%04X is out of reach", arg.text, val)
+		return 0
+	}
+	return uint16(val>>4) & 0x7FF
+}
+
+// listing returns the listing line of the statement
+func (e *encoder) listing() *ListingLine {
+	return e.stmt.src
+}
+
+// describe records the resolved value of an operand for the listing
+func (e *encoder) describe(arg operand, val int, isLabel bool) {
+	_, err := parseNumber(arg.text)
+	switch {
+	case isLabel:
+		e.listing().Value = fmt.Sprintf("%s = x%04X", arg.text, val)
+	case err != nil:
+		e.listing().Value = fmt.Sprintf("%s = #%d", arg.text, val)
+	default:
+		e.listing().Value = fmt.Sprintf("#%d", val)
+	}
+}
+
+// split reads a 16-bit value and returns the operands of the CONST and
+// HICONST pair that loads it
+func (e *encoder) split(n int) (lo uint16, hi uint16) {
+	if n >= len(e.stmt.args) {
+		return 0, 0
+	} else if e.reloc(n, 0, tokenizer.RELOC_LO8) {
+		e.reloc(n, 1, tokenizer.RELOC_HI8)
+		return 0, 0
+	}
+
+	arg := e.stmt.args[n]
+	val, isLabel, err := e.a.value(arg)
+	if err != nil {
+		e.errorf(arg.col, "%s", err)
+		return 0, 0
+	}
+	e.describe(arg, val, isLabel)
+	word := e.fits(arg, val, WORD16)
+	return word & 0xFF, word >> 8
+}
+
+// operands of each instruction, as r for a register and i for anything else.
+// Branches, ADD and AND are handled by encode.
+var operandKinds = map[machine.Op]string{
+	machine.OpNOP:     "",
+	machine.OpRTI:     "",
+	machine.OpRET:     "",
+	machine.OpMUL:     "rrr",
+	machine.OpSUB:     "rrr",
+	machine.OpDIV:     "rrr",
+	machine.OpOR:      "rrr",
+	machine.OpXOR:     "rrr",
+	machine.OpMOD:     "rrr",
+	machine.OpNOT:     "rr",
+	machine.OpCMP:     "rr",
+	machine.OpCMPU:    "rr",
+	machine.OpCMPI:    "ri",
+	machine.OpCMPIU:   "ri",
+	machine.OpJSRR:    "r",
+	machine.OpJMPR:    "r",
+	machine.OpJSR:     "i",
+	machine.OpJMP:     "i",
+	machine.OpTRAP:    "i",
+	machine.OpLDR:     "rri",
+	machine.OpSTR:     "rri",
+	machine.OpSLL:     "rri",
+	machine.OpSRA:     "rri",
+	machine.OpSRL:     "rri",
+	machine.OpCONST:   "ri",
+	machine.OpHICONST: "ri",
+	machine.OpLEA:     "ri",
+	machine.OpLC:      "ri",
+}
+
+// encode fills in the words of an instruction or .FILL
+func (a *assembler) encode(stmt *statement) {
+	e := &encoder{a: a, stmt: stmt}
+	words := stmt.seg.Words[stmt.idx:]
+
+	if stmt.op == ".FILL" {
+		if !e.reloc(0, 0, tokenizer.RELOC_WORD) {
+			words[0] = e.imm(0, WORD16)
+		}
+		return
+	}
+
+	op := mnemonics[stmt.op].op
+	kinds := operandKinds[op]
+	switch op {
+	case machine.OpBRp, machine.OpBRz, machine.OpBRzp, machine.OpBRn, machine.OpBRnp, machine.OpBRnz, machine.OpBRnzp:
+		kinds = "i"
+	case machine.OpADD, machine.OpAND:
+		// the last operand is a register or an immediate
+		kinds = "rrr"
+		if len(stmt.args) == 3 && !isRegister(stmt.args[2].text) {
+			op = map[machine.Op]machine.Op{machine.OpADD: machine.OpADDI, machine.OpAND: machine.OpANDI}[op]
+			kinds = "rri"
+		}
+	}
+	if !a.checkArgs(stmt, len(kinds)) {
+		return
+	}
+
+	// registers, in the order they are written
+	var r [3]uint16
+	for i, kind := range kinds {
+		if kind == 'r' {
+			r[i] = e.reg(i)
+		}
+	}
+
+	switch op {
+	case machine.OpNOP:
+		words[0] = 0x0000
+	case machine.OpBRp, machine.OpBRz, machine.OpBRzp, machine.OpBRn, machine.OpBRnp, machine.OpBRnz, machine.OpBRnzp:
+		nzp := uint16(op - machine.OpNOP)
+		words[0] = nzp<<9 | e.pcOffset(0, IMM9)
+	case machine.OpADD, machine.OpMUL, machine.OpSUB, machine.OpDIV:
+		sub := uint16(op - machine.OpADD)
+		words[0] = 0x1000 | r[0]<<9 | r[1]<<6 | sub<<3 | r[2]
+	case machine.OpADDI:
+		words[0] = 0x1000 | r[0]<<9 | r[1]<<6 | 0x20 | e.imm(2, IMM5)
+	case machine.OpCMP:
+		words[0] = 0x2000 | r[0]<<9 | r[1]
+	case machine.OpCMPU:
+		words[0] = 0x2000 | r[0]<<9 | 1<<7 | r[1]
+	case machine.OpCMPI:
+		words[0] = 0x2000 | r[0]<<9 | 2<<7 | e.imm(1, IMM7)
+	case machine.OpCMPIU:
+		words[0] = 0x2000 | r[0]<<9 | 3<<7 | e.imm(1, UIMM7)
+	case machine.OpJSRR:
+		words[0] = 0x4000 | r[0]<<6
+	case machine.OpJSR:
+		words[0] = 0x4800 | e.jsrTarget(0)
+	case machine.OpAND:
+		words[0] = 0x5000 | r[0]<<9 | r[1]<<6 | r[2]
+	case machine.OpNOT:
+		words[0] = 0x5000 | r[0]<<9 | r[1]<<6 | 1<<3
+	case machine.OpOR:
+		words[0] = 0x5000 | r[0]<<9 | r[1]<<6 | 2<<3 | r[2]
+	case machine.OpXOR:
+		words[0] = 0x5000 | r[0]<<9 | r[1]<<6 | 3<<3 | r[2]
+	case machine.OpANDI:
+		words[0] = 0x5000 | r[0]<<9 | r[1]<<6 | 0x20 | e.imm(2, IMM5)
+	case machine.OpLDR:
+		words[0] = 0x6000 | r[0]<<9 | r[1]<<6 | e.imm(2, IMM6)
+	case machine.OpSTR:
+		words[0] = 0x7000 | r[0]<<9 | r[1]<<6 | e.imm(2, IMM6)
+	case machine.OpRTI:
+		words[0] = 0x8000
+	case machine.OpCONST:
+		words[0] = 0x9000 | r[0]<<9 | e.constImm(1)
+	case machine.OpSLL, machine.OpSRA, machine.OpSRL:
+		sub := uint16(op - machine.OpSLL)
+		words[0] = 0xA000 | r[0]<<9 | r[1]<<6 | sub<<4 | e.imm(2, UIMM4)
+	case machine.OpMOD:
+		words[0] = 0xA000 | r[0]<<9 | r[1]<<6 | 3<<4 | r[2]
+	case machine.OpJMPR:
+		words[0] = 0xC000 | r[0]<<6
+	case machine.OpJMP:
+		words[0] = 0xC800 | e.pcOffset(0, IMM11)
+	case machine.OpHICONST:
+		words[0] = 0xD100 | r[0]<<9 | e.hiconstImm(1)
+	case machine.OpTRAP:
+		words[0] = 0xF000 | e.imm(0, UIMM8)
+	case machine.OpRET:
+		// JMPR R7
+		words[0] = 0xC000 | 7<<6
+	case machine.OpLEA, machine.OpLC:
+		// CONST and HICONST
+		lo, hi := e.split(1)
+		words[0] = 0x9000 | r[0]<<9 | lo
+		words[1] = 0xD100 | r[0]<<9 | hi
+	default:
+		panic(fmt.Sprintf("no encoding for %s", op))
+	}
+}
+
+// constImm reads the operand of CONST, which takes the low byte of an
+// address
+func (e *encoder) constImm(n int) uint16 {
+	if e.reloc(n, 0, tokenizer.RELOC_LO8) {
+		return 0
+	} else if addr, isAddr := e.addr(n); isAddr {
+		return addr & 0xFF
+	}
+	return e.imm(n, IMM9)
+}
+
+// hiconstImm reads the operand of HICONST, which takes the high byte of an
+// address
+func (e *encoder) hiconstImm(n int) uint16 {
+	if e.reloc(n, 0, tokenizer.RELOC_HI8) {
+		return 0
+	} else if addr, isAddr := e.addr(n); isAddr {
+		return addr >> 8
+	}
+	return e.imm(n, UIMM8)
+}
+
+// addr reads an operand that is an address in memory, such as a label
+func (e *encoder) addr(n int) (uint16, bool) {
+	if n >= len(e.stmt.args) {
+		return 0, false
+	}
+
+	arg := e.stmt.args[n]
+	val, isLabel, err := e.a.value(arg)
+	if err != nil || !isLabel || val < 0 || val > 0xFFFF {
+		return 0, false
+	}
+	e.describe(arg, val, true)
+	return uint16(val), true
+}
@@ -0,0 +1,250 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// binary operators, from lowest to highest precedence
+var exprPrecedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// eval evaluates a constant expression of numbers, labels and constants.
+// Operators follow C precedence: unary - ~ +, then * / %, + -, << >>, &, ^, |.
+// A # is read as a unary +, so #-5 and #(W*H) work like -5 and (W*H).
+// addrs is the number of labels added minus the number subtracted, so it is
+// 1 for an address such as LOOP+2 and 0 for a plain number or END-START.
+func (a *assembler) eval(expr string) (val int, addrs int, err error) {
+	v, err := a.parseExpr(expr)
+	if err != nil {
+		return 0, 0, err
+	} else if v.ext != "" {
+		return 0, 0, fmt.Errorf("%s is external, and can only be used as an address", v.ext)
+	}
+	return v.val, v.addrs, nil
+}
+
+// external reads an expression that refers to an .EXTERN symbol, such as
+// PRINT or TABLE+2, and returns the symbol and the offset from it. sym is
+// empty for any other expression.
+func (a *assembler) external(expr string) (sym string, offset int, err error) {
+	v, err := a.parseExpr(expr)
+	return v.ext, v.val, err
+}
+
+func (a *assembler) parseExpr(expr string) (exprValue, error) {
+	p := &exprParser{a: a, src: expr}
+	p.next()
+	if p.tok == "" {
+		return exprValue{}, fmt.Errorf("empty expression")
+	}
+
+	v, err := p.parseBinary(0)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if p.tok != "" {
+		return exprValue{}, fmt.Errorf("unexpected %q in %s", p.tok, expr)
+	}
+	return v, nil
+}
+
+// exprValue is the value of an expression, or its offset from ext if it
+// refers to an .EXTERN symbol
+type exprValue struct {
+	val   int
+	addrs int
+	ext   string
+}
+
+func (v exprValue) offsetError() error {
+	return fmt.Errorf("external symbol %s can only be offset by a constant", v.ext)
+}
+
+type exprParser struct {
+	a   *assembler
+	src string
+	pos int
+	tok string
+}
+
+// next advances to the next token, leaving tok empty at the end of input
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+
+	start := p.pos
+	char := p.src[p.pos]
+	switch {
+	case isIdentChar(char):
+		for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+			p.pos++
+		}
+	case strings.HasPrefix(p.src[p.pos:], "<<") || strings.HasPrefix(p.src[p.pos:], ">>"):
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isIdentChar(char byte) bool {
+	return char == '_' || char == '.' ||
+		('0' <= char && char <= '9') ||
+		('a' <= char && char <= 'z') ||
+		('A' <= char && char <= 'Z')
+}
+
+func (p *exprParser) parseBinary(level int) (exprValue, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+
+	lhs, err := p.parseBinary(level + 1)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	for {
+		op := p.tok
+		if !containsString(exprPrecedence[level], op) {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.parseBinary(level + 1)
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		// an external symbol can only have a constant added or subtracted
+		if lhs.ext != "" && (rhs.ext != "" || (op != "+" && op != "-")) {
+			return exprValue{}, lhs.offsetError()
+		} else if rhs.ext != "" && op != "+" {
+			return exprValue{}, rhs.offsetError()
+		} else if rhs.ext != "" {
+			lhs.ext = rhs.ext
+		}
+
+		// only sums and differences of addresses are still addresses
+		addrs := 0
+		switch op {
+		case "|":
+			lhs.val |= rhs.val
+		case "^":
+			lhs.val ^= rhs.val
+		case "&":
+			lhs.val &= rhs.val
+		case "<<", ">>":
+			// past 15 every bit of a word is shifted out
+			if rhs.val < 0 || rhs.val > 15 {
+				return exprValue{}, fmt.Errorf("shift count %d is out of range (0 to 15) in %s", rhs.val, p.src)
+			}
+			if op == "<<" {
+				lhs.val <<= uint(rhs.val)
+			} else {
+				lhs.val >>= uint(rhs.val)
+			}
+		case "+":
+			lhs.val += rhs.val
+			addrs = lhs.addrs + rhs.addrs
+		case "-":
+			lhs.val -= rhs.val
+			addrs = lhs.addrs - rhs.addrs
+		case "*":
+			lhs.val *= rhs.val
+		case "/", "%":
+			if rhs.val == 0 {
+				return exprValue{}, fmt.Errorf("division by zero in %s", p.src)
+			}
+			if op == "/" {
+				lhs.val /= rhs.val
+			} else {
+				lhs.val %= rhs.val
+			}
+		}
+		lhs.addrs = addrs
+	}
+}
+
+func (p *exprParser) parseUnary() (exprValue, error) {
+	switch p.tok {
+	case "-", "~", "+", "#":
+		op := p.tok
+		p.next()
+		v, err := p.parseUnary()
+		if err != nil {
+			return exprValue{}, err
+		} else if v.ext != "" && op != "+" && op != "#" {
+			return exprValue{}, v.offsetError()
+		}
+
+		if op == "-" {
+			return exprValue{val: -v.val}, nil
+		} else if op == "~" {
+			return exprValue{val: ^v.val}, nil
+		}
+		return v, nil
+	}
+
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (exprValue, error) {
+	tok := p.tok
+	switch tok {
+	case "":
+		return exprValue{}, fmt.Errorf("unexpected end of %s", p.src)
+	case "(":
+		p.next()
+		v, err := p.parseBinary(0)
+		if err != nil {
+			return exprValue{}, err
+		}
+		if p.tok != ")" {
+			return exprValue{}, fmt.Errorf("missing ) in %s", p.src)
+		}
+		p.next()
+		return v, nil
+	}
+
+	if !isIdentChar(tok[0]) {
+		return exprValue{}, fmt.Errorf("unexpected %q in %s", tok, p.src)
+	}
+	p.next()
+
+	// labels and constants take priority over names like xA that look hex
+	if addr, exists := p.a.prog.Symbols[tok]; exists {
+		return exprValue{val: int(addr), addrs: 1}, nil
+	} else if val, exists := p.a.consts[tok]; exists {
+		return exprValue{val: val}, nil
+	} else if p.a.externs[tok] {
+		return exprValue{addrs: 1, ext: tok}, nil
+	}
+
+	val, err := parseNumber(tok)
+	if err != nil && isSymbol(tok) {
+		err = fmt.Errorf("undefined symbol %s", tok)
+	}
+	return exprValue{val: val}, err
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
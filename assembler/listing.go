@@ -0,0 +1,91 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteListing writes every source line with the address and words it
+// assembled to, in hex and binary, and the resolved value of its label or
+// immediate operand, followed by the symbol table
+func (p *Program) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	row := func(line, addr, word, binary, value, source string) {
+		text := fmt.Sprintf("%5s  %-5s  %-5s  %-16s  %-28s  %s", line, addr, word, binary, value, source)
+		fmt.Fprintln(bw, strings.TrimRight(text, " "))
+	}
+
+	row("Line", "Addr", "Word", "Binary", "Value", "Source")
+	file := ""
+	for _, line := range p.Listing {
+		if line.File != file {
+			file = line.File
+			fmt.Fprintf(bw, "; %s\n", file)
+		}
+
+		// lines expanded from a macro are marked with a +
+		num := strconv.Itoa(line.Num)
+		if line.Macro != "" {
+			num += "+"
+		}
+		switch {
+		case len(line.Words) == 0:
+			row(num, "", "", "", "", line.Text)
+		case line.reserved:
+			// .BLKW and .FALIGN only reserve space
+			words := fmt.Sprintf("(%d words)", len(line.Words))
+			row(num, fmt.Sprintf("x%04X", line.Addr), "", words, line.Value, line.Text)
+		default:
+			for i, word := range line.Words {
+				addr, hex, binary := fmt.Sprintf("x%04X", line.Addr+uint16(i)), fmt.Sprintf("x%04X", word), fmt.Sprintf("%016b", word)
+				if i == 0 {
+					row(num, addr, hex, binary, line.Value, line.Text)
+				} else {
+					row("", addr, hex, binary, "", "")
+				}
+			}
+		}
+	}
+
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, "; symbols")
+	for _, name := range p.SymbolNames() {
+		fmt.Fprintf(bw, "x%04X  %s\n", p.Symbols[name], name)
+	}
+
+	if len(p.Consts) > 0 {
+		names := make([]string, 0, len(p.Consts))
+		for name := range p.Consts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "; constants")
+		for _, name := range names {
+			val := p.Consts[name]
+			fmt.Fprintf(bw, "x%04X  %s = #%d\n", uint16(val), name, val)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteListingFile writes the program's listing to a file
+func (p *Program) WriteListingFile(fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := p.WriteListing(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
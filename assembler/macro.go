@@ -0,0 +1,156 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// startMacro begins the definition of a macro, written
+//
+//	.MACRO NAME param1, param2, ...
+//
+// whose body runs to the next .ENDM
+func (a *assembler) startMacro(stmt *statement) {
+	// the body is collected even if the definition is bad, so that it isn't
+	// assembled on its own
+	m := &macro{src: stmt.src}
+	a.defining = m
+	if len(stmt.args) == 0 {
+		a.errorf(stmt.src, stmt.opCol, ".MACRO needs a name")
+		return
+	}
+
+	name := stmt.args[0]
+	for _, param := range stmt.args[1:] {
+		if !isSymbol(param.text) || strings.Contains(param.text, ".") {
+			a.errorf(stmt.src, param.col, "invalid macro parameter %q", param.text)
+			return
+		}
+		m.params = append(m.params, param.text)
+	}
+
+	if !isSymbol(name.text) || strings.Contains(name.text, ".") {
+		a.errorf(stmt.src, name.col, "invalid macro name %q", name.text)
+	} else if _, isInsn := mnemonics[strings.ToUpper(name.text)]; isInsn {
+		a.errorf(stmt.src, name.col, "%s is already an instruction", name.text)
+	} else if _, exists := a.macros[strings.ToUpper(name.text)]; exists {
+		a.errorf(stmt.src, name.col, "macro %s is already defined", name.text)
+	} else {
+		m.name = strings.ToUpper(name.text)
+	}
+}
+
+// defineMacroLine adds a line to the body of the macro being defined, or ends
+// it at .ENDM
+func (a *assembler) defineMacroLine(src *ListingLine) {
+	tokens := lex(src.Text)
+	if len(tokens) > 0 {
+		switch strings.ToUpper(tokens[0].text) {
+		case ".ENDM":
+			if len(tokens) > 1 {
+				a.errorf(src, tokens[1].col, ".ENDM takes no operands")
+			}
+			if m := a.defining; m.name != "" {
+				a.macros[m.name] = m
+			}
+			a.defining = nil
+			return
+		case ".MACRO":
+			a.errorf(src, tokens[0].col, ".MACRO inside another macro's definition")
+			return
+		}
+	}
+	a.defining.lines = append(a.defining.lines, src.Text)
+}
+
+// expand lays out the body of a macro for a call, with each parameter
+// replaced by its argument. Labels in the body written @NAME are local to the
+// call, and become NAME.n for the nth call.
+func (a *assembler) expand(stmt *statement, m *macro) {
+	if !a.checkArgs(stmt, len(m.params)) {
+		return
+	} else if a.depth >= MAX_MACRO_DEPTH {
+		a.errorf(stmt.src, stmt.opCol, "macro calls nested more than %d deep", MAX_MACRO_DEPTH)
+		return
+	}
+
+	a.expansions++
+	suffix := "." + strconv.Itoa(a.expansions)
+	args := map[string]string{}
+	for i, param := range m.params {
+		args[param] = stmt.args[i].text
+	}
+
+	// errors in the expansion are reported at the outermost call
+	call := stmt.src
+	callCol := stmt.opCol
+	if call.Macro != "" {
+		callCol = call.callCol
+	}
+
+	a.depth++
+	for _, line := range m.lines {
+		a.addLine(&ListingLine{
+			File:    call.File,
+			Num:     call.Num,
+			Text:    substitute(line, args, suffix, a.prog.Locals),
+			Macro:   m.name,
+			fileIdx: call.fileIdx,
+			callCol: callCol,
+		})
+	}
+	a.depth--
+}
+
+// substitute replaces the parameters and local labels in a line of a macro
+// body, leaving numbers, strings and the comment as they are, and adds the
+// local labels it names to locals
+func substitute(line string, args map[string]string, suffix string, locals map[string]bool) string {
+	var out strings.Builder
+	for i := 0; i < len(line); {
+		char := line[i]
+		start := i
+		switch {
+		case char == ';':
+			out.WriteString(line[i:])
+			return out.String()
+		case char == '"':
+			i++
+			for i < len(line) && line[i] != '"' {
+				i++
+			}
+			if i < len(line) {
+				i++
+			}
+			out.WriteString(line[start:i])
+		case char == '@' || char == '_' || ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z'):
+			i++
+			for i < len(line) && isIdentChar(line[i]) {
+				i++
+			}
+			word := line[start:i]
+			if arg, isParam := args[word]; isParam {
+				// don't double up the # of an immediate such as #N
+				if start > 0 && line[start-1] == '#' {
+					arg = strings.TrimPrefix(arg, "#")
+				}
+				out.WriteString(arg)
+			} else if char == '@' && isSymbol(word[1:]) {
+				locals[word[1:]+suffix] = true
+				out.WriteString(word[1:] + suffix)
+			} else {
+				out.WriteString(word)
+			}
+		case isIdentChar(char):
+			// numbers such as 10 or 0x10 are never parameters
+			for i < len(line) && isIdentChar(line[i]) {
+				i++
+			}
+			out.WriteString(line[start:i])
+		default:
+			out.WriteByte(char)
+			i++
+		}
+	}
+	return out.String()
+}
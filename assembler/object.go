@@ -0,0 +1,75 @@
+package assembler
+
+import (
+	"github.com/hryoma/lc4go/tokenizer"
+	"io"
+	"os"
+)
+
+// WriteObj writes the program as an object file, with its symbols other than
+// the local labels of macro calls, the source file names, and the source line
+// of every instruction
+func (p *Program) WriteObj(w io.Writer) error {
+	ow := tokenizer.NewWriter(w)
+	for _, seg := range p.Segments {
+		if seg.Data {
+			ow.Data(seg.Addr, seg.Words)
+		} else {
+			ow.Code(seg.Addr, seg.Words)
+		}
+	}
+
+	for _, name := range p.SymbolNames() {
+		if !p.Locals[name] {
+			ow.Symbol(p.Symbols[name], name)
+		}
+	}
+
+	// only in objects that refer to .EXTERN symbols, which need linking
+	for _, reloc := range p.Relocs {
+		ow.Reloc(reloc.Addr, reloc.Kind, uint16(reloc.Offset), reloc.Symbol)
+	}
+
+	for _, file := range p.Files {
+		ow.File(file)
+	}
+
+	for _, line := range p.Lines {
+		ow.Line(line.Addr, line.Line, line.FileIdx)
+	}
+
+	return ow.Flush()
+}
+
+// WriteObjFile writes the program to an object file
+func (p *Program) WriteObjFile(fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := p.WriteObj(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadObj reads an object file written by WriteObj, or by any other LC4
+// assembler, back into a program with no listing
+func ReadObj(r io.Reader) (*Program, error) {
+	obj, err := tokenizer.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{Program: *obj, Consts: map[string]int{}}, nil
+}
+
+func ReadObjFile(fileName string) (*Program, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadObj(file)
+}
@@ -0,0 +1,642 @@
+// Package dap exposes the LC4 machine over the Debug Adapter Protocol, so
+// that editors such as VS Code can debug object files with source line
+// information.
+//
+// A launch request takes the object files to load, in order, as "objects"
+// and/or "program", along with the optional "cwd" and "stopOnEntry". Stepping
+// goes by source line where the object files have line records, and by
+// instruction otherwise or when the client asks for instruction granularity.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const THREAD_ID = 1
+
+// variable references of the scopes
+const (
+	REGISTERS_REF = iota + 1
+	PSR_REF
+)
+
+type Session struct {
+	writer    io.Writer
+	writeLock sync.Mutex
+	seq       int
+
+	requests chan *request
+	// set to stop a running program, to report a pause or to end the session
+	paused int32
+	quit   int32
+	// closed when the running program stops, or nil if none has started
+	running chan struct{}
+
+	// breakpoint addresses, by the source path they were set in. The lock
+	// guards breakpoints, which the running program reads.
+	sourceBreakpoints map[string][]uint16
+	breakpoints       map[uint16]bool
+	breakpointsLock   sync.Mutex
+
+	stopOnEntry bool
+	// the directory relative file names are resolved against, from the
+	// launch request
+	cwd string
+}
+
+// ListenAndServe accepts DAP connections on addr, one at a time, until a
+// client disconnects with a terminate or disconnect request
+func ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	fmt.Println("Listening for DAP on", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("DAP client connected from", conn.RemoteAddr())
+		done := NewSession(conn, conn).Serve()
+		conn.Close()
+		if done {
+			return nil
+		}
+		fmt.Println("DAP client disconnected")
+	}
+}
+
+func NewSession(reader io.Reader, writer io.Writer) *Session {
+	s := &Session{
+		writer:            writer,
+		requests:          make(chan *request),
+		sourceBreakpoints: map[string][]uint16{},
+		breakpoints:       map[uint16]bool{},
+	}
+	go s.readRequests(bufio.NewReader(reader))
+	return s
+}
+
+// Serve answers requests until the client disconnects or the connection
+// closes, and reports whether the client ended the session. The program runs
+// on its own goroutine, so pause and disconnect are answered while it runs.
+func (s *Session) Serve() (done bool) {
+	defer s.stop()
+
+	for req := range s.requests {
+		if req.Command == "disconnect" || req.Command == "terminate" {
+			s.stop()
+			s.respond(req, nil)
+			return true
+		}
+		s.handle(req)
+	}
+	return false
+}
+
+// readRequests decodes requests until the connection closes
+func (s *Session) readRequests(reader *bufio.Reader) {
+	defer close(s.requests)
+
+	for {
+		req, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+		s.requests <- req
+	}
+}
+
+// isRunning reports whether the program is running
+func (s *Session) isRunning() bool {
+	if s.running == nil {
+		return false
+	}
+	select {
+	case <-s.running:
+		return false
+	default:
+		return true
+	}
+}
+
+// start runs the program on another goroutine, see run
+func (s *Session) start(mode string, byInsn bool) {
+	atomic.StoreInt32(&s.paused, 0)
+	running := make(chan struct{})
+	s.running = running
+	go func() {
+		report := s.run(mode, byInsn)
+		// the program has stopped by the time the client hears about it
+		close(running)
+		if report != nil {
+			report()
+		}
+	}()
+}
+
+// stop ends the running program without reporting why, and waits for it
+func (s *Session) stop() {
+	if s.running == nil {
+		return
+	}
+	atomic.StoreInt32(&s.quit, 1)
+	<-s.running
+	atomic.StoreInt32(&s.quit, 0)
+}
+
+func (s *Session) send(msg interface{}) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+	writeMessage(s.writer, msg)
+}
+
+func (s *Session) respond(req *request, body interface{}) {
+	s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    true,
+		Command:    req.Command,
+		Body:       body,
+	})
+}
+
+func (s *Session) fail(req *request, format string, args ...interface{}) {
+	s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    false,
+		Command:    req.Command,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (s *Session) sendEvent(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *Session) stopped(reason string) {
+	s.sendEvent("stopped", map[string]interface{}{
+		"reason":            reason,
+		"threadId":          THREAD_ID,
+		"allThreadsStopped": true,
+	})
+}
+
+// stopper returns a func that reports a stop for reason
+func (s *Session) stopper(reason string) func() {
+	return func() {
+		s.stopped(reason)
+	}
+}
+
+func (s *Session) handle(req *request) {
+	// only requests that leave the machine alone are answered while running
+	if s.isRunning() {
+		switch req.Command {
+		case "pause", "threads", "setBreakpoints", "setExceptionBreakpoints":
+		default:
+			s.fail(req, "The program is running")
+			return
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsReadMemoryRequest":        true,
+			"supportsSetVariable":              true,
+			"supportsSteppingGranularity":      true,
+			"supportsTerminateRequest":         true,
+		})
+	case "launch":
+		s.launch(req)
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+	case "setExceptionBreakpoints":
+		s.respond(req, map[string]interface{}{"breakpoints": []breakpoint{}})
+	case "configurationDone":
+		s.respond(req, nil)
+		if s.stopOnEntry {
+			s.stopped("entry")
+		} else {
+			s.start("continue", false)
+		}
+	case "threads":
+		s.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": THREAD_ID, "name": "LC4"}},
+		})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.respond(req, map[string]interface{}{
+			"scopes": []scope{
+				{Name: "Registers", VariablesReference: REGISTERS_REF},
+				{Name: "PSR", VariablesReference: PSR_REF},
+			},
+		})
+	case "variables":
+		s.variables(req)
+	case "setVariable":
+		s.setVariable(req)
+	case "continue":
+		s.respond(req, map[string]bool{"allThreadsContinued": true})
+		s.start("continue", false)
+	case "next", "stepIn", "stepOut":
+		args := stepArguments{}
+		json.Unmarshal(req.Arguments, &args)
+		s.respond(req, nil)
+		s.start(req.Command, args.Granularity == "instruction")
+	case "pause":
+		s.respond(req, nil)
+		if s.isRunning() {
+			// the running program notices the flag and reports the pause
+			atomic.StoreInt32(&s.paused, 1)
+		} else {
+			s.stopped("pause")
+		}
+	case "evaluate":
+		s.evaluate(req)
+	case "readMemory":
+		s.readMemory(req)
+	default:
+		s.fail(req, "Unsupported request %q", req.Command)
+	}
+}
+
+func (s *Session) launch(req *request) {
+	args := launchArguments{}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, "Invalid launch arguments: %s", err)
+		return
+	}
+
+	// the working directory is shared by the whole process, so it is left
+	// alone and relative names are resolved against cwd instead
+	s.cwd = ""
+	if args.Cwd != "" {
+		if info, err := os.Stat(args.Cwd); err != nil || !info.IsDir() {
+			s.fail(req, "Invalid cwd: %s", args.Cwd)
+			return
+		}
+		s.cwd = args.Cwd
+	}
+
+	fileNames := args.Objects
+	if args.Program != "" {
+		fileNames = append(fileNames, args.Program)
+	}
+	if len(fileNames) == 0 {
+		s.fail(req, "No object files to load")
+		return
+	}
+
+	for i, fileName := range fileNames {
+		fileNames[i] = s.path(fileName)
+		if _, err := os.Stat(fileNames[i]); err != nil {
+			s.fail(req, "File not found: %s", fileName)
+			return
+		}
+	}
+
+	emulator.Clear()
+	for _, fileName := range fileNames {
+		if err := emulator.Load(fileName); err != nil {
+			s.fail(req, "%s", err)
+			return
+		}
+	}
+	s.sourceBreakpoints = map[string][]uint16{}
+	s.breakpoints = map[uint16]bool{}
+	s.stopOnEntry = args.StopOnEntry
+
+	s.respond(req, nil)
+	s.sendEvent("initialized", nil)
+}
+
+func (s *Session) setBreakpoints(req *request) {
+	args := setBreakpointsArguments{}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, "Invalid setBreakpoints arguments: %s", err)
+		return
+	}
+
+	addrs := []uint16{}
+	results := make([]breakpoint, len(args.Breakpoints))
+	for i, sbp := range args.Breakpoints {
+		addr, line, ok := s.lineAddr(args.Source.Path, sbp.Line)
+		if !ok {
+			results[i] = breakpoint{Line: sbp.Line, Message: "No code at this line"}
+			continue
+		}
+		addrs = append(addrs, addr)
+		results[i] = breakpoint{Verified: true, Line: line}
+	}
+	s.sourceBreakpoints[args.Source.Path] = addrs
+
+	breakpoints := map[uint16]bool{}
+	for _, addrs := range s.sourceBreakpoints {
+		for _, addr := range addrs {
+			breakpoints[addr] = true
+		}
+	}
+	s.breakpointsLock.Lock()
+	s.breakpoints = breakpoints
+	s.breakpointsLock.Unlock()
+
+	s.respond(req, map[string]interface{}{"breakpoints": results})
+}
+
+// lineAddr finds the first address of the first line with code at or after
+// line in the source file at path
+func (s *Session) lineAddr(path string, line int) (addr uint16, codeLine int, ok bool) {
+	for a, meta := range machine.Lc4.Meta {
+		if meta.Line == 0 || int(meta.Line) < line || !s.sameFile(fileName(meta.File), path) {
+			continue
+		}
+		if !ok || int(meta.Line) < codeLine || (int(meta.Line) == codeLine && a < addr) {
+			addr, codeLine, ok = a, int(meta.Line), true
+		}
+	}
+	return
+}
+
+// sameFile reports whether a file name recorded in an object file names the
+// file at path. Object files often record bare or relative names, so base
+// names match too.
+func (s *Session) sameFile(name string, path string) bool {
+	if name == "" {
+		return false
+	}
+	if s.path(name) == filepath.Clean(path) {
+		return true
+	}
+	return filepath.Base(name) == filepath.Base(path)
+}
+
+// path returns the absolute path of a file name, resolving relative names
+// against the launch request's cwd
+func (s *Session) path(name string) string {
+	if s.cwd != "" && !filepath.IsAbs(name) {
+		name = filepath.Join(s.cwd, name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+func fileName(idx int) string {
+	if idx < 0 || idx >= len(machine.Lc4.Files) {
+		return ""
+	}
+	return machine.Lc4.Files[idx]
+}
+
+// sourceLine returns the source line of addr, if the object files recorded one
+func sourceLine(addr uint16) (file int, line int, ok bool) {
+	meta := machine.Lc4.Meta[addr]
+	if meta.Line == 0 || fileName(meta.File) == "" {
+		return 0, 0, false
+	}
+	return meta.File, int(meta.Line), true
+}
+
+func (s *Session) stackTrace(req *request) {
+	frames := []stackFrame{}
+	for n, pc := range emulator.FramePcs() {
+		frame := stackFrame{
+			// some clients take id 0 to mean no frame
+			Id:                          n + 1,
+			Name:                        emulator.Symbolize(pc),
+			InstructionPointerReference: fmt.Sprintf("0x%04X", pc),
+		}
+		if file, line, ok := sourceLine(pc); ok {
+			name := fileName(file)
+			frame.Source = &source{Name: filepath.Base(name), Path: s.path(name)}
+			frame.Line = line
+			frame.Column = 1
+		}
+		frames = append(frames, frame)
+	}
+
+	s.respond(req, map[string]interface{}{
+		"stackFrames": frames,
+		"totalFrames": len(frames),
+	})
+}
+
+func (s *Session) variables(req *request) {
+	args := variablesArguments{}
+	json.Unmarshal(req.Arguments, &args)
+
+	vars := []variable{}
+	switch args.VariablesReference {
+	case REGISTERS_REF:
+		for i, val := range machine.Lc4.Reg {
+			vars = append(vars, wordVariable(fmt.Sprintf("R%d", i), val))
+		}
+		vars = append(vars, wordVariable("PC", machine.Lc4.Pc))
+		vars = append(vars, wordVariable("PSR", machine.Lc4.Psr))
+	case PSR_REF:
+		psr := machine.Lc4.Psr
+		vars = append(vars,
+			variable{Name: "N", Value: strconv.Itoa(int(psr>>2) & 1)},
+			variable{Name: "Z", Value: strconv.Itoa(int(psr>>1) & 1)},
+			variable{Name: "P", Value: strconv.Itoa(int(psr) & 1)},
+			variable{Name: "Privilege", Value: strconv.FormatBool(psr&0x8000 != 0)},
+		)
+	}
+
+	s.respond(req, map[string]interface{}{"variables": vars})
+}
+
+func wordVariable(name string, val uint16) variable {
+	return variable{
+		Name:            name,
+		Value:           formatWord(val),
+		MemoryReference: fmt.Sprintf("0x%04X", val),
+	}
+}
+
+func formatWord(val uint16) string {
+	return fmt.Sprintf("0x%04X (%d)", val, int16(val))
+}
+
+// setVariable sets a register, or the pc or psr, to an expression
+func (s *Session) setVariable(req *request) {
+	args := setVariableArguments{}
+	json.Unmarshal(req.Arguments, &args)
+	if args.VariablesReference != REGISTERS_REF {
+		s.fail(req, "Only registers can be set")
+		return
+	}
+
+	val, err := emulator.Eval(args.Value)
+	if err != nil {
+		s.fail(req, "Invalid value: %s", err)
+		return
+	}
+
+	name := strings.ToUpper(args.Name)
+	switch {
+	case name == "PC":
+		machine.Lc4.Pc = val
+	case name == "PSR":
+		machine.Lc4.Psr = val
+	case len(name) == 2 && name[0] == 'R' && '0' <= name[1] && name[1] < '0'+machine.NUM_REGS:
+		machine.Lc4.Reg[name[1]-'0'] = val
+	default:
+		s.fail(req, "No register %q", args.Name)
+		return
+	}
+
+	s.respond(req, map[string]string{"value": formatWord(val)})
+}
+
+func (s *Session) evaluate(req *request) {
+	args := evaluateArguments{}
+	json.Unmarshal(req.Arguments, &args)
+
+	val, err := emulator.Eval(args.Expression)
+	if err != nil {
+		s.fail(req, "%s", err)
+		return
+	}
+
+	s.respond(req, map[string]interface{}{
+		"result":             formatWord(val),
+		"variablesReference": 0,
+		"memoryReference":    fmt.Sprintf("0x%04X", val),
+	})
+}
+
+// readMemory reads words as bytes, two per word, most significant byte first.
+// The memory reference is a word address and the offset counts bytes from it.
+func (s *Session) readMemory(req *request) {
+	args := readMemoryArguments{}
+	json.Unmarshal(req.Arguments, &args)
+
+	base, err := emulator.Eval(args.MemoryReference)
+	if err != nil {
+		s.fail(req, "Invalid memory reference: %s", err)
+		return
+	}
+
+	start := int(base)*2 + args.Offset
+	if start < 0 {
+		start = 0
+	}
+	end := start + args.Count
+	if end > machine.MEM_SIZE*2 {
+		end = machine.MEM_SIZE * 2
+	}
+
+	data := []byte{}
+	for i := start; i < end; i++ {
+		word := machine.Lc4.Mem[i/2]
+		if i%2 == 0 {
+			data = append(data, byte(word>>8))
+		} else {
+			data = append(data, byte(word))
+		}
+	}
+
+	s.respond(req, map[string]interface{}{
+		"address":         fmt.Sprintf("0x%04X", start/2),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - len(data),
+	})
+}
+
+// run executes for a continue, next, stepIn or stepOut request, and returns
+// a func that reports why it stopped, or nil if it was stopped by stop
+func (s *Session) run(mode string, byInsn bool) (report func()) {
+	startFile, startLine, hasLine := sourceLine(machine.Lc4.Pc)
+	byInsn = byInsn || !hasLine
+	depth := emulator.CallDepth()
+
+	// newLine reports whether execution reached the start of another line
+	newLine := func() bool {
+		if byInsn {
+			return true
+		}
+		file, line, ok := sourceLine(machine.Lc4.Pc)
+		return ok && (file != startFile || line != startLine)
+	}
+
+	for {
+		switch err := emulator.Exec(); err {
+		case nil:
+		case emulator.ErrHalted:
+			return func() {
+				s.sendEvent("exited", map[string]int{"exitCode": 0})
+				s.sendEvent("terminated", nil)
+			}
+		default:
+			return func() {
+				s.sendEvent("stopped", map[string]interface{}{
+					"reason":            "exception",
+					"description":       "Execution error",
+					"threadId":          THREAD_ID,
+					"allThreadsStopped": true,
+				})
+			}
+		}
+
+		if atomic.LoadInt32(&s.quit) == 1 {
+			return nil
+		}
+		s.breakpointsLock.Lock()
+		hit := s.breakpoints[machine.Lc4.Pc]
+		s.breakpointsLock.Unlock()
+		if hit {
+			return s.stopper("breakpoint")
+		}
+		if atomic.SwapInt32(&s.paused, 0) == 1 {
+			return s.stopper("pause")
+		}
+
+		switch mode {
+		case "stepIn":
+			if newLine() {
+				return s.stopper("step")
+			}
+		case "next":
+			if emulator.CallDepth() <= depth && newLine() {
+				return s.stopper("step")
+			}
+		case "stepOut":
+			if emulator.CallDepth() < depth {
+				return s.stopper("step")
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeTestObj writes an object file with line records for prog.asm:
+//
+//	3: CONST R0, #5
+//	4: ADD R1, R0, R0
+//	5: TRAP xFF
+func writeTestObj(t *testing.T, dir string) string {
+	words := []uint16{
+		0xCADE, 0x8200, 3, 0x9005, 0x1200, 0xF0FF,
+		0xF17E, 8,
+	}
+	data := []byte{}
+	for _, word := range words {
+		data = binary.BigEndian.AppendUint16(data, word)
+	}
+	data = append(data, "prog.asm"...)
+	for i, line := range []uint16{3, 4, 5} {
+		for _, word := range []uint16{0x715E, 0x8200 + uint16(i), line, 0} {
+			data = binary.BigEndian.AppendUint16(data, word)
+		}
+	}
+
+	fileName := filepath.Join(dir, "prog.obj")
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	seq    int
+}
+
+func (c *testClient) request(command string, args interface{}) {
+	c.seq++
+	msg := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		msg["arguments"] = args
+	}
+	if err := writeMessage(c.conn, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() map[string]interface{} {
+	header, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		c.t.Fatal(err)
+	}
+
+	msg := map[string]interface{}{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// expect reads the next message and checks that it is the given response or
+// event
+func (c *testClient) expect(kind string, name string) map[string]interface{} {
+	msg := c.read()
+	key := map[string]string{"response": "command", "event": "event"}[kind]
+	if msg["type"] != kind || msg[key] != name {
+		c.t.Fatalf("Expected %s %s but got %v", kind, name, msg)
+	}
+	if kind == "response" && msg["success"] != true {
+		c.t.Fatalf("Request %s failed: %v", name, msg["message"])
+	}
+	body, _ := msg["body"].(map[string]interface{})
+	return body
+}
+
+func startSession(t *testing.T) *testClient {
+	server, client := net.Pipe()
+	session := NewSession(server, server)
+	go func() {
+		session.Serve()
+		server.Close()
+	}()
+	t.Cleanup(func() { client.Close() })
+	return &testClient{t: t, conn: client, reader: bufio.NewReader(client)}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	writeTestObj(t, dir)
+	wd, _ := os.Getwd()
+
+	c := startSession(t)
+	c.request("initialize", map[string]string{"adapterID": "lc4"})
+	if body := c.expect("response", "initialize"); body["supportsReadMemoryRequest"] != true {
+		t.Error("Expected readMemory support but got", body)
+	}
+
+	c.request("launch", map[string]interface{}{"program": "prog.obj", "cwd": dir})
+	c.expect("response", "launch")
+	c.expect("event", "initialized")
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("Expected the working directory to stay %s but got %s", wd, now)
+	}
+
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": filepath.Join(dir, "prog.asm")},
+		"breakpoints": []map[string]int{{"line": 4}, {"line": 9}},
+	})
+	bps := c.expect("response", "setBreakpoints")["breakpoints"].([]interface{})
+	if bp := bps[0].(map[string]interface{}); bp["verified"] != true || bp["line"] != 4.0 {
+		t.Error("Expected a verified breakpoint at line 4 but got", bp)
+	}
+	if bp := bps[1].(map[string]interface{}); bp["verified"] != false {
+		t.Error("Expected an unverified breakpoint at line 9 but got", bp)
+	}
+
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone")
+	if body := c.expect("event", "stopped"); body["reason"] != "breakpoint" {
+		t.Error("Expected to stop at a breakpoint but got", body)
+	}
+	if machine.Lc4.Pc != 0x8201 {
+		t.Errorf("Expected pc 0x8201 but got 0x%04X", machine.Lc4.Pc)
+	}
+
+	c.request("stackTrace", map[string]int{"threadId": THREAD_ID})
+	frames := c.expect("response", "stackTrace")["stackFrames"].([]interface{})
+	if frame := frames[0].(map[string]interface{}); frame["line"] != 4.0 {
+		t.Error("Expected frame at line 4 but got", frame)
+	} else if path := frame["source"].(map[string]interface{})["path"]; path != filepath.Join(dir, "prog.asm") {
+		t.Error("Expected the source path to be resolved against cwd but got", path)
+	}
+
+	c.request("evaluate", map[string]string{"expression": "R0 + 1"})
+	if body := c.expect("response", "evaluate"); body["result"] != "0x0006 (6)" {
+		t.Error("Expected 0x0006 (6) but got", body["result"])
+	}
+
+	c.request("readMemory", map[string]interface{}{"memoryReference": "0x8200", "count": 4})
+	if body := c.expect("response", "readMemory"); body["data"] != "kAUSAA==" {
+		t.Error("Expected kAUSAA== but got", body["data"])
+	}
+
+	c.request("next", map[string]int{"threadId": THREAD_ID})
+	c.expect("response", "next")
+	c.expect("event", "stopped")
+	if machine.Lc4.Reg[1] != 10 {
+		t.Error("Expected R1 to be 10 but got", machine.Lc4.Reg[1])
+	}
+
+	c.request("continue", map[string]int{"threadId": THREAD_ID})
+	c.expect("response", "continue")
+	c.expect("event", "exited")
+	c.expect("event", "terminated")
+
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+}
+
+func TestPauseAndDisconnectWhileRunning(t *testing.T) {
+	dir := t.TempDir()
+	// 0x8200: BRnzp #-1, which loops forever
+	data := []byte{}
+	for _, word := range []uint16{0xCADE, 0x8200, 1, 0x0FFF} {
+		data = binary.BigEndian.AppendUint16(data, word)
+	}
+	program := filepath.Join(dir, "loop.obj")
+	if err := os.WriteFile(program, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startSession(t)
+	c.request("launch", map[string]interface{}{"program": program})
+	c.expect("response", "launch")
+	c.expect("event", "initialized")
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone")
+
+	c.request("stackTrace", map[string]int{"threadId": THREAD_ID})
+	if msg := c.read(); msg["success"] != false || msg["message"] != "The program is running" {
+		t.Error("Expected stackTrace to fail while running, but got", msg)
+	}
+
+	c.request("pause", map[string]int{"threadId": THREAD_ID})
+	c.expect("response", "pause")
+	if body := c.expect("event", "stopped"); body["reason"] != "pause" {
+		t.Error("Expected to stop for the pause but got", body)
+	}
+
+	c.request("stackTrace", map[string]int{"threadId": THREAD_ID})
+	frames := c.expect("response", "stackTrace")["stackFrames"].([]interface{})
+	if frame := frames[0].(map[string]interface{}); frame["id"] != 1.0 {
+		t.Error("Expected the first frame to have id 1 but got", frame)
+	}
+
+	c.request("continue", map[string]int{"threadId": THREAD_ID})
+	c.expect("response", "continue")
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+}
+
+func TestLaunchError(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "bad.asm")
+	if err := os.WriteFile(program, []byte("\tADD R1, R9, R1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startSession(t)
+	c.request("launch", map[string]interface{}{"program": program})
+	if msg := c.read(); msg["success"] != false || msg["message"] != program+`:1:10: expected a register but got "R9"` {
+		t.Error("Expected launch to fail with the assembler's error, but got", msg)
+	}
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/spf13/cobra"
+	"strconv"
+	"strings"
+)
+
+// block collects the lines of a define or commands block until its end
+type block struct {
+	finish func(lines []string)
+	lines  []string
+	depth  int
+}
+
+var pendingBlock *block
+
+var defineCmd = &cobra.Command{
+	Use:   "define",
+	Short: "Define a command from the following lines, up to end. Use $arg0, $arg1, ... and $argc for its arguments",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		name := args[0]
+		if existing, _, err := rootCmd.Find([]string{name}); err == nil && existing != rootCmd && !isUserCommand(existing) {
+			fmt.Println("Cannot redefine built-in command:", name)
+			return
+		}
+
+		startBlock(func(lines []string) {
+			defineUserCommand(name, lines)
+		})
+	},
+}
+
+var commandsCmd = &cobra.Command{
+	Use:   "commands",
+	Short: "Run the following lines, up to end, whenever a breakpoint is hit",
+	Run: func(cmd *cobra.Command, args []string) {
+		strNum := ""
+		if len(args) == 1 {
+			strNum = args[0]
+		} else if len(args) > 1 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		if !emulator.BreakpointExists(strNum) {
+			return
+		}
+		startBlock(func(lines []string) {
+			emulator.SetBreakpointCommands(strNum, lines)
+		})
+	},
+}
+
+func startBlock(finish func(lines []string)) {
+	fmt.Println("Type commands, one per line, ending with a line saying just \"end\".")
+	pendingBlock = &block{finish: finish}
+}
+
+// collectLine adds a line to the pending block, finishing it at its end
+func collectLine(line string) {
+	args := splitArgs(line)
+	if len(args) == 1 && args[0] == "end" {
+		if pendingBlock.depth == 0 {
+			b := pendingBlock
+			pendingBlock = nil
+			b.finish(b.lines)
+			return
+		}
+		pendingBlock.depth--
+	} else if len(args) > 0 && (args[0] == "define" || args[0] == "commands") {
+		// nested blocks keep their own end
+		pendingBlock.depth++
+	}
+
+	pendingBlock.lines = append(pendingBlock.lines, strings.TrimSpace(line))
+}
+
+func isUserCommand(cmd *cobra.Command) bool {
+	_, exists := cmd.Annotations["user"]
+	return exists
+}
+
+func defineUserCommand(name string, lines []string) {
+	// replace any previous definition
+	if existing, _, err := rootCmd.Find([]string{name}); err == nil && isUserCommand(existing) {
+		rootCmd.RemoveCommand(existing)
+	}
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:                name,
+		Short:              "User-defined",
+		Annotations:        map[string]string{"user": ""},
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			runUserCommand(lines, args)
+		},
+	})
+}
+
+func runUserCommand(lines []string, args []string) {
+	if nestDepth >= MAX_NEST_DEPTH {
+		fmt.Println("Commands nested too deeply")
+		return
+	}
+	nestDepth++
+	defer func() {
+		nestDepth--
+	}()
+
+	// substitute from the highest argument down, so $arg1 doesn't match $arg10
+	replacements := []string{"$argc", strconv.Itoa(len(args))}
+	for i := len(args) - 1; i >= 0; i-- {
+		replacements = append(replacements, "$arg"+strconv.Itoa(i), args[i])
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	for _, line := range lines {
+		feedLine(replacer.Replace(line))
+	}
+}
@@ -0,0 +1,281 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Breakpoint struct {
+	Num      int
+	Addr     uint16
+	Enabled  bool
+	Temp     bool
+	Ignore   int
+	Hits     int
+	Commands []string
+	// dprintf breakpoints print instead of stopping
+	Dprintf bool
+	Format  string
+	Args    []string
+	// watchpoints stop when the value of Expr changes from OldValue to Value,
+	// and have no address
+	Watch    bool
+	Expr     string
+	Value    uint16
+	OldValue uint16
+}
+
+var breakpoints []*Breakpoint
+var nextBreakpointNum = 1
+
+// the breakpoint that stopped the last run, until its commands are taken
+var stopBreakpoint *Breakpoint
+
+func addBreakpoint(strAddr string, temp bool) *Breakpoint {
+	addr, err := parseAddr(strAddr)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return nil
+	}
+
+	return AddBreakpoint(addr, temp)
+}
+
+// AddBreakpoint sets a breakpoint at addr without printing anything
+func AddBreakpoint(addr uint16, temp bool) *Breakpoint {
+	bp := &Breakpoint{
+		Num:     nextBreakpointNum,
+		Addr:    addr,
+		Enabled: true,
+		Temp:    temp,
+	}
+	breakpoints = append(breakpoints, bp)
+	nextBreakpointNum++
+	return bp
+}
+
+// Breakpoints returns every breakpoint, in the order they were set
+func Breakpoints() []*Breakpoint {
+	return append([]*Breakpoint{}, breakpoints...)
+}
+
+// LookupBreakpoint returns the numbered breakpoint, or nil if there is none
+func LookupBreakpoint(num int) *Breakpoint {
+	for _, bp := range breakpoints {
+		if bp.Num == num {
+			return bp
+		}
+	}
+	return nil
+}
+
+func SetBreakpoint(strAddr string) {
+	if bp := addBreakpoint(strAddr, false); bp != nil {
+		fmt.Printf("Breakpoint %d at %s\n", bp.Num, formatAddr(bp.Addr))
+	}
+}
+
+func SetTempBreakpoint(strAddr string) {
+	if bp := addBreakpoint(strAddr, true); bp != nil {
+		fmt.Printf("Temporary breakpoint %d at %s\n", bp.Num, formatAddr(bp.Addr))
+	}
+}
+
+func InfoBreakpoints() {
+	if len(breakpoints) == 0 {
+		fmt.Println("No breakpoints.")
+		return
+	}
+
+	fmt.Println("Num\tType\t\tDisp\tEnb\tAddress")
+	for _, bp := range breakpoints {
+		disp := "keep"
+		if bp.Temp {
+			disp = "del"
+		}
+		enb := "n"
+		if bp.Enabled {
+			enb = "y"
+		}
+		if bp.Watch {
+			fmt.Printf("%d\twatchpoint\t%s\t%s\t%s\n", bp.Num, disp, enb, bp.Expr)
+		} else if bp.Dprintf {
+			fmt.Printf("%d\tdprintf\t\t%s\t%s\t%s\n", bp.Num, disp, enb, formatAddr(bp.Addr))
+			fmt.Printf("\t\tprintf %s\n", strings.Join(append([]string{strconv.Quote(bp.Format)}, bp.Args...), ", "))
+		} else {
+			fmt.Printf("%d\tbreakpoint\t%s\t%s\t%s\n", bp.Num, disp, enb, formatAddr(bp.Addr))
+		}
+
+		if bp.Hits == 1 {
+			fmt.Println("\tbreakpoint already hit 1 time")
+		} else if bp.Hits > 1 {
+			fmt.Printf("\tbreakpoint already hit %d times\n", bp.Hits)
+		}
+		if bp.Ignore > 0 {
+			fmt.Printf("\tWill ignore next %d crossings of breakpoint.\n", bp.Ignore)
+		}
+		for _, line := range bp.Commands {
+			fmt.Printf("\t\t%s\n", line)
+		}
+	}
+}
+
+// DeleteBreakpoints deletes the numbered breakpoints, or all of them if no
+// numbers are given
+func DeleteBreakpoints(strNums []string) {
+	if len(strNums) == 0 {
+		breakpoints = nil
+		return
+	}
+
+	for _, strNum := range strNums {
+		if bp := findBreakpoint(strNum); bp != nil {
+			RemoveBreakpoint(bp)
+		}
+	}
+}
+
+// EnableBreakpoints enables the numbered breakpoints, or all of them if no
+// numbers are given
+func EnableBreakpoints(strNums []string) {
+	setEnabled(strNums, true)
+}
+
+// DisableBreakpoints disables the numbered breakpoints, or all of them if no
+// numbers are given
+func DisableBreakpoints(strNums []string) {
+	setEnabled(strNums, false)
+}
+
+func setEnabled(strNums []string, enabled bool) {
+	if len(strNums) == 0 {
+		for _, bp := range breakpoints {
+			bp.Enabled = enabled
+		}
+		return
+	}
+
+	for _, strNum := range strNums {
+		if bp := findBreakpoint(strNum); bp != nil {
+			bp.Enabled = enabled
+		}
+	}
+}
+
+// IgnoreBreakpoint skips the next count crossings of a breakpoint
+func IgnoreBreakpoint(strNum string, strCount string) {
+	bp := findBreakpoint(strNum)
+	if bp == nil {
+		return
+	}
+
+	count, err := strconv.Atoi(strCount)
+	if err != nil || count < 0 {
+		fmt.Println("Invalid count:", strCount)
+		return
+	}
+
+	bp.Ignore = count
+	if count == 0 {
+		fmt.Printf("Will stop next time breakpoint %d is reached.\n", bp.Num)
+	} else {
+		fmt.Printf("Will ignore next %d crossings of breakpoint %d.\n", count, bp.Num)
+	}
+}
+
+func findBreakpoint(strNum string) *Breakpoint {
+	num, err := strconv.Atoi(strNum)
+	if err != nil {
+		fmt.Println("Invalid breakpoint number:", strNum)
+		return nil
+	}
+
+	if bp := LookupBreakpoint(num); bp != nil {
+		return bp
+	}
+
+	fmt.Println("No breakpoint number", num)
+	return nil
+}
+
+// RemoveBreakpoint deletes a breakpoint
+func RemoveBreakpoint(target *Breakpoint) {
+	for i, bp := range breakpoints {
+		if bp == target {
+			breakpoints = append(breakpoints[:i], breakpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkBreakpoints counts a crossing of every enabled breakpoint at addr,
+// prints any dprintf messages, and returns the breakpoint that should stop
+// execution, if any
+func checkBreakpoints(addr uint16) (hit *Breakpoint) {
+	for _, bp := range breakpoints {
+		if bp.Watch || bp.Addr != addr || !bp.Enabled {
+			continue
+		}
+
+		bp.Hits++
+		if bp.Ignore > 0 {
+			bp.Ignore--
+			continue
+		}
+
+		if bp.Dprintf {
+			fmt.Print(sprintfLc4(bp.Format, bp.Args))
+			continue
+		}
+
+		if hit == nil {
+			hit = bp
+		}
+	}
+
+	if hit != nil && hit.Temp {
+		RemoveBreakpoint(hit)
+	}
+	return
+}
+
+// BreakpointExists reports whether strNum names a breakpoint, printing an
+// error if it doesn't. An empty strNum names the most recent breakpoint.
+func BreakpointExists(strNum string) bool {
+	if strNum == "" {
+		if len(breakpoints) == 0 {
+			fmt.Println("No breakpoints.")
+			return false
+		}
+		return true
+	}
+	return findBreakpoint(strNum) != nil
+}
+
+// SetBreakpointCommands attaches a list of REPL commands that run whenever the
+// breakpoint stops execution. An empty strNum names the most recent breakpoint.
+func SetBreakpointCommands(strNum string, lines []string) {
+	var bp *Breakpoint
+	if strNum == "" && len(breakpoints) > 0 {
+		bp = breakpoints[len(breakpoints)-1]
+	} else if strNum != "" {
+		bp = findBreakpoint(strNum)
+	}
+
+	if bp != nil {
+		bp.Commands = lines
+	}
+}
+
+// TakeStopCommands returns the commands of the breakpoint that last stopped
+// execution, so that they run only once per stop
+func TakeStopCommands() []string {
+	if stopBreakpoint == nil {
+		return nil
+	}
+
+	lines := stopBreakpoint.Commands
+	stopBreakpoint = nil
+	return lines
+}
@@ -0,0 +1,54 @@
+package emulator
+
+import (
+	"testing"
+)
+
+func TestBreakpointByLabel(t *testing.T) {
+	loadCallProgram()
+	SetBreakpoint("SUB")
+	Continue()
+
+	if bp := breakpoints[0]; bp.Addr != 0x0010 || bp.Hits != 1 {
+		t.Errorf("Expected breakpoint at 0x0010 hit once, but got 0x%04X hit %d times", bp.Addr, bp.Hits)
+	}
+}
+
+func TestBreakpointIgnoreCount(t *testing.T) {
+	loadCallProgram()
+	SetBreakpoint("0x0010")
+	IgnoreBreakpoint("1", "1")
+
+	if hit := checkBreakpoints(0x0010); hit != nil {
+		t.Error("Expected the first crossing to be ignored")
+	}
+	if hit := checkBreakpoints(0x0010); hit == nil {
+		t.Error("Expected the second crossing to stop")
+	}
+}
+
+func TestTempBreakpointIsDeleted(t *testing.T) {
+	loadCallProgram()
+	SetTempBreakpoint("0x0010")
+
+	if hit := checkBreakpoints(0x0010); hit == nil {
+		t.Error("Expected the temporary breakpoint to stop")
+	}
+	if len(breakpoints) != 0 {
+		t.Error("Expected the temporary breakpoint to be deleted, but found", len(breakpoints))
+	}
+}
+
+func TestBreakpointsSurviveReset(t *testing.T) {
+	loadCallProgram()
+	SetBreakpoint("0x0010")
+	DisableBreakpoints([]string{"1"})
+	Reset()
+
+	if len(breakpoints) != 1 || breakpoints[0].Enabled {
+		t.Error("Expected one disabled breakpoint after reset")
+	}
+	if hit := checkBreakpoints(0x0010); hit != nil {
+		t.Error("Expected a disabled breakpoint not to stop")
+	}
+}
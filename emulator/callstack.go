@@ -0,0 +1,154 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"sort"
+)
+
+// Frame is one entry of the shadow call stack. Frames are pushed by JSR,
+// JSRR and TRAP and popped by the matching RET/JMPR R7 or RTI.
+type Frame struct {
+	CallSite uint16
+	Entry    uint16
+	Return   uint16
+	Trap     bool
+}
+
+var callStack []Frame
+var selectedFrame int
+
+func trackCall(pc uint16, insn machine.Insn) {
+	switch insn.OpName {
+	case machine.OpJSR, machine.OpJSRR, machine.OpTRAP:
+		callStack = append(callStack, Frame{
+			CallSite: pc,
+			Entry:    machine.Lc4.Pc,
+			Return:   pc + 1,
+			Trap:     insn.OpName == machine.OpTRAP,
+		})
+	case machine.OpJMPR:
+		if insn.Rs == 7 {
+			popFrame()
+		}
+	case machine.OpRTI:
+		popFrame()
+	}
+
+	// any execution moves the selection back to the innermost frame
+	selectedFrame = 0
+}
+
+func popFrame() {
+	// unwind to the frame that returns to the new pc, if there is one
+	for i := len(callStack) - 1; i >= 0; i-- {
+		if callStack[i].Return == machine.Lc4.Pc {
+			callStack = callStack[:i]
+			return
+		}
+	}
+
+	// otherwise the callee returned somewhere unexpected, drop the top frame
+	if len(callStack) > 0 {
+		callStack = callStack[:len(callStack)-1]
+	}
+}
+
+// CallDepth returns the number of active calls on the shadow call stack
+func CallDepth() int {
+	return len(callStack)
+}
+
+// FramePcs returns the pc of every frame, starting with the innermost one
+func FramePcs() []uint16 {
+	pcs := make([]uint16, numFrames())
+	for n := range pcs {
+		pcs[n] = framePc(n)
+	}
+	return pcs
+}
+
+func numFrames() int {
+	return len(callStack) + 1
+}
+
+// framePc returns the pc of frame n, where frame 0 is the innermost frame
+func framePc(n int) uint16 {
+	if n == 0 {
+		return machine.Lc4.Pc
+	}
+	return callStack[len(callStack)-n].CallSite
+}
+
+func frameString(n int) string {
+	pc := framePc(n)
+	str := fmt.Sprintf("#%d  0x%04X in %s", n, pc, Symbolize(pc))
+	if n < len(callStack) {
+		ret := callStack[len(callStack)-1-n].Return
+		str += ", returns to " + formatAddr(ret)
+	}
+	return str
+}
+
+// formatAddr prints addr along with its label, if it has one nearby
+func formatAddr(addr uint16) string {
+	if sym := Symbolize(addr); sym != "??" {
+		return fmt.Sprintf("0x%04X <%s>", addr, sym)
+	}
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+// Symbolize describes addr relative to the nearest label at or below it
+func Symbolize(addr uint16) string {
+	if meta, exists := machine.Lc4.Meta[addr]; exists && meta.Label != "" {
+		return meta.Label
+	}
+
+	labels := make([]string, 0, len(machine.Lc4.Labels))
+	for label := range machine.Lc4.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	best := ""
+	for _, label := range labels {
+		labelAddr := machine.Lc4.Labels[label]
+		if labelAddr <= addr && (best == "" || labelAddr > machine.Lc4.Labels[best]) {
+			best = label
+		}
+	}
+
+	if best == "" {
+		return "??"
+	} else if addr == machine.Lc4.Labels[best] {
+		return best
+	}
+	return fmt.Sprintf("%s+%d", best, addr-machine.Lc4.Labels[best])
+}
+
+func Backtrace() {
+	for n := 0; n < numFrames(); n++ {
+		fmt.Println(frameString(n))
+	}
+}
+
+func Up(count int) {
+	selectFrame(selectedFrame + count)
+}
+
+func Down(count int) {
+	selectFrame(selectedFrame - count)
+}
+
+func selectFrame(n int) {
+	if n < 0 {
+		fmt.Println("Bottom (innermost) frame selected; you cannot go down.")
+		return
+	} else if n >= numFrames() {
+		fmt.Println("Initial frame selected; you cannot go up.")
+		return
+	}
+
+	selectedFrame = n
+	fmt.Println(frameString(n))
+}
@@ -0,0 +1,77 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func loadCallProgram() {
+	Clear()
+	machine.Lc4.Pc = 0x0000
+
+	// 0x0000: JSR SUB
+	// 0x0001: NOP
+	// 0x0010: SUB: ADD R5, R7, R0
+	// 0x0011: TRAP x20
+	// 0x0012: ADD R7, R5, R0
+	// 0x0013: RET
+	// 0x8020: RTI
+	machine.Lc4.Mem[0x0000] = 0x4801
+	machine.Lc4.Mem[0x0001] = 0x0000
+	machine.Lc4.Mem[0x0010] = 0x1BC0
+	machine.Lc4.Mem[0x0011] = 0xF020
+	machine.Lc4.Mem[0x0012] = 0x1F40
+	machine.Lc4.Mem[0x0013] = 0xC1C0
+	machine.Lc4.Mem[0x8020] = 0x8000
+	machine.Lc4.Labels["MAIN"] = 0x0000
+	machine.Lc4.Labels["SUB"] = 0x0010
+}
+
+func TestCallStackTracksCallsAndReturns(t *testing.T) {
+	loadCallProgram()
+
+	expected := []int{1, 1, 2, 1, 1, 0}
+	for i, depth := range expected {
+		Step(1)
+		if CallDepth() != depth {
+			t.Error("Step", i, "expected call depth", depth, "but got", CallDepth())
+		}
+	}
+
+	if machine.Lc4.Pc != 0x0001 {
+		t.Errorf("Expected pc 0x0001 after return, but got 0x%04X", machine.Lc4.Pc)
+	}
+}
+
+func TestCallStackFrames(t *testing.T) {
+	loadCallProgram()
+	Step(1)
+	Step(1)
+	Step(1)
+
+	if framePc(0) != 0x8020 {
+		t.Errorf("Expected frame 0 at 0x8020, but got 0x%04X", framePc(0))
+	}
+	if framePc(1) != 0x0011 {
+		t.Errorf("Expected frame 1 at 0x0011, but got 0x%04X", framePc(1))
+	}
+	if framePc(2) != 0x0000 {
+		t.Errorf("Expected frame 2 at 0x0000, but got 0x%04X", framePc(2))
+	}
+
+	expected := "#1  0x0011 in SUB+1, returns to 0x0001 <MAIN+1>"
+	if actual := frameString(1); actual != expected {
+		t.Error("Expected", expected, "but got", actual)
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	loadCallProgram()
+
+	if actual := Symbolize(0x0010); actual != "SUB" {
+		t.Error("Expected SUB but got", actual)
+	}
+	if actual := Symbolize(0x0012); actual != "SUB+2" {
+		t.Error("Expected SUB+2 but got", actual)
+	}
+}
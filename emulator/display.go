@@ -0,0 +1,130 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Display struct {
+	Num    int
+	Expr   string
+	Format byte
+}
+
+var displays []*Display
+var nextDisplayNum = 1
+
+// AddDisplay evaluates expr after every stop. spec is the optional /<fmt>
+// suffix of the command, with /i disassembling at the address expr gives.
+func AddDisplay(spec string, expr string) {
+	var format byte
+	if spec = strings.TrimPrefix(spec, "/"); spec != "" {
+		if len(spec) != 1 || !strings.Contains("xdutci", spec) {
+			fmt.Println("Invalid format:", spec)
+			return
+		}
+		format = spec[0]
+	}
+
+	if _, err := Eval(expr); err != nil {
+		fmt.Println("Invalid expression:", err)
+		return
+	}
+
+	d := &Display{
+		Num:    nextDisplayNum,
+		Expr:   expr,
+		Format: format,
+	}
+	displays = append(displays, d)
+	nextDisplayNum++
+	showDisplay(d)
+}
+
+// Undisplay deletes the numbered displays, or all of them if no numbers are
+// given
+func Undisplay(strNums []string) {
+	if len(strNums) == 0 {
+		displays = nil
+		return
+	}
+
+	for _, strNum := range strNums {
+		num, err := strconv.Atoi(strNum)
+		if err != nil {
+			fmt.Println("Invalid display number:", strNum)
+			continue
+		}
+
+		found := false
+		for i, d := range displays {
+			if d.Num == num {
+				displays = append(displays[:i], displays[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Println("No display number", num)
+		}
+	}
+}
+
+func InfoDisplay() {
+	if len(displays) == 0 {
+		fmt.Println("There are no auto-display expressions now.")
+		return
+	}
+
+	fmt.Println("Auto-display expressions now in effect:")
+	fmt.Println("Num\tExpression")
+	for _, d := range displays {
+		if d.Format != 0 {
+			fmt.Printf("%d\t/%c %s\n", d.Num, d.Format, d.Expr)
+		} else {
+			fmt.Printf("%d\t%s\n", d.Num, d.Expr)
+		}
+	}
+}
+
+// showDisplays prints every display, and is called whenever execution stops
+func showDisplays() {
+	for _, d := range displays {
+		showDisplay(d)
+	}
+}
+
+func showDisplay(d *Display) {
+	val, err := Eval(d.Expr)
+	if err != nil {
+		fmt.Printf("%d: %s = <error: %s>\n", d.Num, d.Expr, err)
+		return
+	}
+
+	switch d.Format {
+	case 0:
+		fmt.Printf("%d: %s = 0x%04X (%d)\n", d.Num, d.Expr, val, int16(val))
+	case 'i':
+		fmt.Printf("%d: x/i %s\n%s:\t%s\n", d.Num, d.Expr, formatAddr(val), disassemble(val))
+	default:
+		fmt.Printf("%d: /%c %s = %s\n", d.Num, d.Format, d.Expr, formatValue(val, d.Format))
+	}
+}
+
+// formatValue formats a word in any examine format but i
+func formatValue(val uint16, format byte) string {
+	switch format {
+	case 'd':
+		return strconv.Itoa(int(int16(val)))
+	case 'u':
+		return strconv.Itoa(int(val))
+	case 't':
+		return fmt.Sprintf("0b%016b", val)
+	case 'c':
+		if val <= 0x7F {
+			return strconv.QuoteRune(rune(val))
+		}
+	}
+	return fmt.Sprintf("0x%04X", val)
+}
@@ -0,0 +1,34 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestDisplayAddAndUndisplay(t *testing.T) {
+	loadCallProgram()
+	AddDisplay("/x", "R7")
+	AddDisplay("", "[SUB]")
+	AddDisplay("", "R9")
+
+	if len(displays) != 2 {
+		t.Fatal("Expected 2 displays, but got", len(displays))
+	}
+	if displays[0].Format != 'x' || displays[1].Format != 0 {
+		t.Error("Expected formats x and none, but got", displays[0].Format, displays[1].Format)
+	}
+
+	Undisplay([]string{"1"})
+	if len(displays) != 1 || displays[0].Num != 2 {
+		t.Error("Expected only display 2 to remain")
+	}
+}
+
+func TestEvalExprDereference(t *testing.T) {
+	loadCallProgram()
+	machine.Lc4.Reg[6] = 0x0010
+
+	if val, err := Eval("[R6]"); err != nil || val != 0x1BC0 {
+		t.Errorf("Expected [R6] = 0x1BC0, but got 0x%04X (%v)", val, err)
+	}
+}
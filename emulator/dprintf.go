@@ -0,0 +1,141 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"strconv"
+	"strings"
+)
+
+// SetDprintf sets a breakpoint that prints a message and keeps going. line is
+// the location, a quoted printf format and its arguments, separated by commas.
+func SetDprintf(line string) {
+	parts := splitTopLevel(line, ',')
+	if len(parts) < 2 {
+		fmt.Println("Format string required")
+		return
+	}
+
+	format, err := strconv.Unquote(strings.TrimSpace(parts[1]))
+	if err != nil {
+		fmt.Println("Invalid format string:", strings.TrimSpace(parts[1]))
+		return
+	}
+
+	args := parts[2:]
+	for i, arg := range args {
+		args[i] = strings.TrimSpace(arg)
+		if _, err := Eval(args[i]); err != nil {
+			fmt.Println("Invalid expression:", err)
+			return
+		}
+	}
+
+	if bp := addBreakpoint(strings.TrimSpace(parts[0]), false); bp != nil {
+		bp.Dprintf = true
+		bp.Format = format
+		bp.Args = args
+		fmt.Printf("Dprintf %d at %s\n", bp.Num, formatAddr(bp.Addr))
+	}
+}
+
+// splitTopLevel splits str on sep, except inside quotes, brackets and
+// parentheses
+func splitTopLevel(str string, sep rune) (parts []string) {
+	depth, inQuote, escaped := 0, false, false
+	start := 0
+
+	for i, char := range str {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && char == '\\':
+			escaped = true
+		case char == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case char == '(' || char == '[':
+			depth++
+		case char == ')' || char == ']':
+			depth--
+		case char == sep && depth == 0:
+			parts = append(parts, str[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, str[start:])
+}
+
+// sprintfLc4 formats values like printf. %d, %u, %x, %X, %o, %b and %c format
+// a word, and %s prints the null-terminated LC4 string at an address. Flags
+// and widths such as %04x are passed through.
+func sprintfLc4(format string, args []string) string {
+	var out strings.Builder
+	argIdx := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		// find the verb, keeping any flags and width
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+# 0123456789", format[j]) >= 0 {
+			j++
+		}
+		if j == len(format) {
+			out.WriteString(format[i:])
+			break
+		}
+
+		spec, verb := format[i+1:j], format[j]
+		i = j
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if argIdx == len(args) {
+			out.WriteString("%!" + string(verb) + "(MISSING)")
+			continue
+		}
+		val, err := Eval(args[argIdx])
+		argIdx++
+		if err != nil {
+			out.WriteString("<error: " + err.Error() + ">")
+			continue
+		}
+
+		switch verb {
+		case 'd', 'i':
+			out.WriteString(fmt.Sprintf("%"+spec+"d", int16(val)))
+		case 'u':
+			out.WriteString(fmt.Sprintf("%"+spec+"d", val))
+		case 'x', 'X', 'o', 'b':
+			out.WriteString(fmt.Sprintf("%"+spec+string(verb), val))
+		case 'c':
+			out.WriteString(fmt.Sprintf("%"+spec+"c", rune(val)))
+		case 's':
+			out.WriteString(fmt.Sprintf("%"+spec+"s", readString(val)))
+		default:
+			out.WriteString("%!" + string(verb) + "(BADVERB)")
+		}
+	}
+
+	return out.String()
+}
+
+// readString reads a null-terminated LC4 string, one char per word
+func readString(addr uint16) string {
+	var str strings.Builder
+	for i := 0; i < machine.MEM_SIZE; i++ {
+		char := machine.Lc4.Mem[addr+uint16(i)]
+		if char == 0 {
+			break
+		}
+		str.WriteRune(rune(char))
+	}
+	return str.String()
+}
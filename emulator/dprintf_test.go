@@ -0,0 +1,60 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestSprintfLc4(t *testing.T) {
+	loadCallProgram()
+	machine.Lc4.Reg[1] = 0xFFFF
+	machine.Lc4.Mem[0x2000] = 'h'
+	machine.Lc4.Mem[0x2001] = 'i'
+	machine.Lc4.Mem[0x2002] = 0
+
+	actual := sprintfLc4("%d %u %04x %c %s %%", []string{"R1", "R1", "SUB", "72", "0x2000"})
+	expected := "-1 65535 0010 H hi %"
+	if actual != expected {
+		t.Errorf("Expected %q but got %q", expected, actual)
+	}
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	parts := splitTopLevel(`LOOP, "a, b", [R6 + (1, 2)], R1`, ',')
+	expected := []string{"LOOP", ` "a, b"`, " [R6 + (1, 2)]", " R1"}
+
+	if len(parts) != len(expected) {
+		t.Fatal("Expected", expected, "but got", parts)
+	}
+	for i := range expected {
+		if parts[i] != expected[i] {
+			t.Errorf("Part %d: expected %q but got %q", i, expected[i], parts[i])
+		}
+	}
+}
+
+func TestDprintfDoesNotStop(t *testing.T) {
+	loadCallProgram()
+	SetDprintf(`SUB, "in sub\n"`)
+
+	if hit := checkBreakpoints(0x0010); hit != nil {
+		t.Error("Expected dprintf not to stop execution")
+	}
+	if breakpoints[0].Hits != 1 {
+		t.Error("Expected dprintf to count 1 hit, but got", breakpoints[0].Hits)
+	}
+}
+
+func TestDprintfOnStep(t *testing.T) {
+	loadCallProgram()
+	SetDprintf(`SUB, "in sub\n"`)
+
+	// JSR SUB steps onto the dprintf
+	Step(1)
+	if breakpoints[0].Hits != 1 {
+		t.Error("Expected stepping onto a dprintf to count 1 hit, but got", breakpoints[0].Hits)
+	}
+	if stopBreakpoint != nil {
+		t.Error("Expected dprintf not to stop")
+	}
+}
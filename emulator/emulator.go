@@ -1,75 +1,156 @@
 package emulator
 
 import (
+	"errors"
 	"fmt"
+	"github.com/hryoma/lc4go/assembler"
 	"github.com/hryoma/lc4go/machine"
 	"github.com/hryoma/lc4go/tokenizer"
-	"strconv"
+	"path/filepath"
+	"strings"
 )
 
 const PC_INIT_VAL = 0x8200
 const PSR_INIT_VAL = 0x8002
 const PC_TERM = 0x80FF
+const RET_VAL_REG = 0
 
-func Breakpoint(strAddr string) {
-	if addr, err := strconv.ParseUint(strAddr, 0, 16); err == nil {
-
-		if meta, exists := machine.Lc4.Meta[uint16(addr)]; exists {
-			meta.Breakpoint = true
-		} else {
-			machine.Lc4.Meta[uint16(addr)] = machine.MemMetadata{
-				Breakpoint: true,
-			}
-		}
-		fmt.Printf("Breakpoint set at 0x%04X\n", addr)
-	} else {
-		fmt.Println("Invalid address:", strAddr)
-	}
-}
+var ErrHalted = errors.New("program halted")
+var ErrExecution = errors.New("execution error")
+var ErrOutermost = errors.New("not meaningful in the outermost frame")
 
 func Clear() {
 	machine.Lc4.Mem = [machine.MEM_SIZE]uint16{}
 	machine.Lc4.Meta = map[uint16]machine.MemMetadata{}
+	machine.Lc4.Labels = map[string]uint16{}
+	machine.Lc4.Files = nil
+	machine.Lc4.Blocks = nil
+	machine.Lc4.LabelSources = nil
+	machine.Lc4.FileSources = nil
+	breakpoints = nil
+	nextBreakpointNum = 1
+	stopBreakpoint = nil
+	displays = nil
+	nextDisplayNum = 1
 	Reset()
 }
 
+// StopReason says why a run stopped
+type StopReason string
+
+const (
+	StopDone       StopReason = "done"
+	StopBreakpoint StopReason = "breakpoint"
+	StopHalted     StopReason = "halted"
+	StopError      StopReason = "error"
+)
+
+// Stop describes why a run stopped, along with the breakpoint hit, if any
+type Stop struct {
+	Reason     StopReason
+	Breakpoint *Breakpoint
+}
+
 func Continue() {
-	for {
-		if ok := Step(); !ok {
-			return
-		}
+	reportStop(Resume())
+	showDisplays()
+}
 
-		// stop if breakpoint is hit
-		addr := machine.Lc4.Pc
-		if meta, exists := machine.Lc4.Meta[addr]; exists && meta.Breakpoint {
-			fmt.Printf("Hit breakpoint at 0x%04X\n", addr)
-			return
-		}
+// Load loads an object file, or assembles and loads a .asm source file.
+// Warnings are printed, and the error says why nothing was loaded.
+func Load(fileName string) error {
+	if strings.EqualFold(filepath.Ext(fileName), ".asm") {
+		return LoadAsm(fileName)
 	}
+	return LoadObj(fileName)
 }
 
-func Load(fileName string) {
-	tokenizer.TokenizeObj(fileName)
+func LoadObj(fileName string) error {
+	return tokenizer.TokenizeObj(fileName)
 }
 
-func Next() {
-	nextPc := machine.Lc4.Pc + 1
-	for {
-		if ok := Step(); !ok {
-			return
-		}
+// LoadAsm assembles a source file in memory and loads the result along with
+// its symbols and line numbers, with the same checks as an object file. The
+// error is the assembler's if the source has errors.
+func LoadAsm(fileName string) error {
+	prog, err := assembler.AssembleFile(fileName)
+	if err != nil {
+		return err
+	} else if len(prog.Relocs) > 0 {
+		return fmt.Errorf("%s refers to .EXTERN symbols, assemble and link it first", fileName)
+	}
 
-		if machine.Lc4.Pc == nextPc {
-			return
-		}
+	warnings, err := tokenizer.LoadProgram(&prog.Program, fileName, tokenizer.LoadPolicy)
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s: %v\n", fileName, warning)
+	}
+	if err != nil {
+		return fmt.Errorf("could not load %s:\n%w", fileName, err)
+	}
+	return nil
+}
 
-		// stop if breakpoint is hit
-		addr := machine.Lc4.Pc
-		if meta, exists := machine.Lc4.Meta[addr]; exists && meta.Breakpoint {
-			fmt.Printf("Hit breakpoint at 0x%04X\n", addr)
-			return
+// DumpObj saves memory from strStart to strEnd, inclusive, to an object file,
+// along with the labels and line numbers in that range
+func DumpObj(strStart string, strEnd string, fileName string) {
+	start, err := parseAddr(strStart)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+	end, err := parseAddr(strEnd)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+	if end < start {
+		fmt.Println("Invalid range: end address is before start address")
+		return
+	}
+
+	if err := tokenizer.WriteMemFile(fileName, start, end); err != nil {
+		fmt.Println("Could not write object file:", err)
+		return
+	}
+	fmt.Printf("Wrote 0x%04X-0x%04X to %s\n", start, end, fileName)
+}
+
+// Next executes count instructions, stepping over JSR, JSRR and TRAP by
+// running until the matching return, and stops early at a breakpoint or when
+// the program terminates
+func Next(count int) {
+	for i := 0; i < count; i++ {
+		if !nextInsn() || stopBreakpoint != nil {
+			break
 		}
 	}
+	showDisplays()
+}
+
+func nextInsn() (ok bool) {
+	insn := machine.Decode(machine.Lc4.Pc)
+	switch insn.OpName {
+	case machine.OpJSR, machine.OpJSRR, machine.OpTRAP:
+		return reportStop(StepOver())
+	}
+	return stepInsn()
+}
+
+// Finish runs until the selected frame returns, then prints the return value
+func Finish() {
+	if selectedFrame >= len(callStack) {
+		fmt.Println("\"finish\" not meaningful in the outermost frame.")
+		return
+	}
+
+	fmt.Println("Run till exit from", frameString(selectedFrame))
+	stop, _ := StepOut()
+
+	if returned := reportStop(stop); returned {
+		retVal := machine.Lc4.Reg[RET_VAL_REG]
+		fmt.Printf("Value returned: R%d = 0x%04X (%d)\n", RET_VAL_REG, retVal, int16(retVal))
+	}
+	showDisplays()
 }
 
 func Print() {
@@ -84,12 +165,21 @@ func PrintCode() {
 	fmt.Printf("0x%04X:\t0b%016b / 0x%04X\n", pc, data, data)
 }
 
+// PrintExpr evaluates an expression and prints its value
+func PrintExpr(expr string) {
+	if val, err := Eval(expr); err == nil {
+		fmt.Printf("%s = 0x%04X (%d)\n", expr, val, int16(val))
+	} else {
+		fmt.Println("Invalid expression:", err)
+	}
+}
+
 func PrintMem(strAddr string) {
-	if addr, err := strconv.ParseUint(strAddr, 0, 16); err == nil {
+	if addr, err := parseAddr(strAddr); err == nil {
 		data := machine.Lc4.Mem[addr]
 		fmt.Printf("0x%04X:\t0b%016b / 0x%04X\n", addr, data, data)
 	} else {
-		fmt.Println("Invalid address:", strAddr)
+		fmt.Println("Invalid address:", err)
 	}
 }
 
@@ -130,17 +220,143 @@ func Reset() {
 	machine.Lc4.Reg = [machine.NUM_REGS]uint16{}
 	machine.Lc4.Pc = PC_INIT_VAL
 	machine.Lc4.Psr = PSR_INIT_VAL
+	callStack = nil
+	selectedFrame = 0
 }
 
-func Step() (ok bool) {
-	if machine.Lc4.Pc == PC_TERM {
+// RunUntil executes until done reports true, stopping early if a breakpoint or
+// watchpoint is hit or the program terminates. Only dprintf breakpoints print anything.
+func RunUntil(done func() bool) Stop {
+	stopBreakpoint = nil
+	syncWatchpoints()
+	for {
+		switch err := Exec(); err {
+		case nil:
+		case ErrHalted:
+			return Stop{Reason: StopHalted}
+		default:
+			return Stop{Reason: StopError}
+		}
+
+		// stop if breakpoint is hit
+		if bp := checkStop(machine.Lc4.Pc); bp != nil {
+			stopBreakpoint = bp
+			if done() {
+				return Stop{Reason: StopDone, Breakpoint: bp}
+			}
+			return Stop{Reason: StopBreakpoint, Breakpoint: bp}
+		}
+
+		if done() {
+			return Stop{Reason: StopDone}
+		}
+	}
+}
+
+// Resume runs until a breakpoint is hit or the program terminates
+func Resume() Stop {
+	return RunUntil(func() bool {
 		return false
+	})
+}
+
+// StepOver executes one instruction, running JSR, JSRR and TRAP until the
+// matching return
+func StepOver() Stop {
+	insn := machine.Decode(machine.Lc4.Pc)
+	switch insn.OpName {
+	case machine.OpJSR, machine.OpJSRR, machine.OpTRAP:
+		depth := len(callStack)
+		return RunUntil(func() bool {
+			return len(callStack) <= depth
+		})
 	}
+	return RunUntil(func() bool {
+		return true
+	})
+}
 
-	if err := machine.Execute(); err != 0 {
+// StepOut runs until the selected frame returns
+func StepOut() (Stop, error) {
+	if selectedFrame >= len(callStack) {
+		return Stop{}, ErrOutermost
+	}
+
+	depth := len(callStack) - selectedFrame - 1
+	return RunUntil(func() bool {
+		return len(callStack) <= depth
+	}), nil
+}
+
+// reportStop prints why a run stopped, and reports whether it stopped because
+// it was done
+func reportStop(stop Stop) bool {
+	if stop.Reason == StopError {
 		fmt.Println("Execution error")
+	}
+
+	if bp := stop.Breakpoint; bp != nil {
+		if bp.Watch {
+			fmt.Printf("Watchpoint %d: %s\n", bp.Num, bp.Expr)
+			fmt.Printf("Old value = 0x%04X (%d)\n", bp.OldValue, int16(bp.OldValue))
+			fmt.Printf("New value = 0x%04X (%d)\n", bp.Value, int16(bp.Value))
+		} else if bp.Temp {
+			fmt.Printf("Hit temporary breakpoint %d at %s\n", bp.Num, formatAddr(bp.Addr))
+		} else {
+			fmt.Printf("Hit breakpoint %d at %s\n", bp.Num, formatAddr(bp.Addr))
+		}
+	}
+	return stop.Reason == StopDone
+}
+
+// Step executes count instructions, stopping early at a breakpoint or when the
+// program terminates
+func Step(count int) (ok bool) {
+	for i := 0; i < count; i++ {
+		if ok = stepInsn(); !ok || stopBreakpoint != nil {
+			break
+		}
+	}
+	showDisplays()
+	return
+}
+
+func stepInsn() (ok bool) {
+	stopBreakpoint = nil
+	syncWatchpoints()
+	if err := Exec(); err != nil {
+		if err == ErrExecution {
+			fmt.Println("Execution error")
+		}
 		return false
 	}
 
+	// stepping onto a breakpoint crosses it like running does, so dprintf
+	// messages print and hits are counted
+	if bp := checkStop(machine.Lc4.Pc); bp != nil {
+		stopBreakpoint = bp
+		reportStop(Stop{Reason: StopBreakpoint, Breakpoint: bp})
+	}
 	return true
 }
+
+// Exec executes one instruction and tracks calls, without printing anything
+func Exec() error {
+	if machine.Lc4.Pc == PC_TERM {
+		return ErrHalted
+	}
+
+	pc := machine.Lc4.Pc
+	insn := machine.Decode(pc)
+	if err := machine.Execute(); err != 0 {
+		return ErrExecution
+	}
+	trackCall(pc, insn)
+
+	return nil
+}
+
+// parseAddr evaluates an address expression, see Eval
+func parseAddr(strAddr string) (uint16, error) {
+	return Eval(strAddr)
+}
@@ -0,0 +1,149 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/assembler"
+	"github.com/hryoma/lc4go/machine"
+	"github.com/hryoma/lc4go/tokenizer"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNextStepsOverCall(t *testing.T) {
+	loadCallProgram()
+	Next(1)
+
+	if machine.Lc4.Pc != 0x0001 {
+		t.Errorf("Expected pc 0x0001 after next, but got 0x%04X", machine.Lc4.Pc)
+	}
+	if CallDepth() != 0 {
+		t.Error("Expected call depth 0 after next, but got", CallDepth())
+	}
+}
+
+func TestNextSingleSteps(t *testing.T) {
+	loadCallProgram()
+	Step(1)
+	Next(1)
+
+	if machine.Lc4.Pc != 0x0011 {
+		t.Errorf("Expected pc 0x0011 after next, but got 0x%04X", machine.Lc4.Pc)
+	}
+}
+
+func TestStepAndNextCounts(t *testing.T) {
+	loadCallProgram()
+	Step(3)
+	if machine.Lc4.Pc != 0x8020 {
+		t.Errorf("Expected pc 0x8020 after 3 steps, but got 0x%04X", machine.Lc4.Pc)
+	}
+
+	// stepping stops early at a breakpoint
+	loadCallProgram()
+	SetBreakpoint("0x0011")
+	Step(5)
+	if machine.Lc4.Pc != 0x0011 {
+		t.Errorf("Expected to stop at the breakpoint at 0x0011, but got 0x%04X", machine.Lc4.Pc)
+	}
+	Next(2)
+	if machine.Lc4.Pc != 0x0013 {
+		t.Errorf("Expected pc 0x0013 after next 2, but got 0x%04X", machine.Lc4.Pc)
+	}
+}
+
+func TestFinishReturnsToCaller(t *testing.T) {
+	loadCallProgram()
+	Step(1)
+	Step(1)
+	Step(1)
+	Finish()
+
+	if machine.Lc4.Pc != 0x0012 {
+		t.Errorf("Expected pc 0x0012 after finish, but got 0x%04X", machine.Lc4.Pc)
+	}
+	if CallDepth() != 1 {
+		t.Error("Expected call depth 1 after finish, but got", CallDepth())
+	}
+}
+
+func TestLoadAsm(t *testing.T) {
+	Clear()
+	fileName := filepath.Join(t.TempDir(), "prog.asm")
+	src := "\t.CODE\n\t.ADDR x0010\nMAIN\tCONST R0, #5\n\tRET\n"
+	if err := os.WriteFile(fileName, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Load(fileName)
+
+	if machine.Lc4.Mem[0x0010] != 0x9005 || machine.Lc4.Mem[0x0011] != 0xC1C0 {
+		t.Errorf("Unexpected code x%04X x%04X", machine.Lc4.Mem[0x0010], machine.Lc4.Mem[0x0011])
+	}
+	if machine.Lc4.Labels["MAIN"] != 0x0010 || machine.Lc4.Meta[0x0010].Label != "MAIN" {
+		t.Error("Expected MAIN at 0x0010 but got", machine.Lc4.Labels)
+	}
+	if meta := machine.Lc4.Meta[0x0011]; meta.Line != 4 || machine.Lc4.Files[meta.File] != fileName {
+		t.Error("Unexpected line info", meta, machine.Lc4.Files)
+	}
+}
+
+func TestLoadAsmChecks(t *testing.T) {
+	Clear()
+	fileName := filepath.Join(t.TempDir(), "prog.asm")
+	if err := os.WriteFile(fileName, []byte("\t.ADDR x2000\n\tADD R1, R1, R1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// code in a data region is only a warning by default
+	tokenizer.LoadPolicy = tokenizer.StrictPolicy
+	defer func() {
+		tokenizer.LoadPolicy = tokenizer.DefaultPolicy
+	}()
+	Load(fileName)
+	if machine.Lc4.Mem[0x2000] != 0 || len(machine.Lc4.Blocks) != 0 {
+		t.Error("Expected nothing to load with the strict policy")
+	}
+
+	tokenizer.LoadPolicy = tokenizer.DefaultPolicy
+	Load(fileName)
+	if machine.Lc4.Mem[0x2000] != 0x1241 || len(machine.Lc4.Blocks) != 1 {
+		t.Errorf("Expected x1241 at x2000 but got x%04X", machine.Lc4.Mem[0x2000])
+	}
+}
+
+func TestDumpObj(t *testing.T) {
+	Clear()
+	asmFile := filepath.Join(t.TempDir(), "prog.asm")
+	if err := os.WriteFile(asmFile, []byte("MAIN\tCONST R0, #5\n\tRET\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Load(asmFile)
+
+	// patched memory is saved along with the labels and lines
+	machine.Lc4.Mem[0x0000] = 0x9007
+	objFile := filepath.Join(t.TempDir(), "patched.obj")
+	DumpObj("MAIN", "MAIN+1", objFile)
+
+	prog, err := assembler.ReadObjFile(objFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.Segments) != 1 || prog.Segments[0].Words[0] != 0x9007 || prog.Segments[0].Words[1] != 0xC1C0 {
+		t.Error("Unexpected segments", prog.Segments)
+	}
+	if line, _ := prog.LineAt(1); prog.Symbols["MAIN"] != 0 || len(prog.Files) != 1 || line.Line != 2 {
+		t.Error("Unexpected debug info", prog.Symbols, prog.Files, prog.Lines)
+	}
+}
+
+func TestLoadAsmErrors(t *testing.T) {
+	Clear()
+	fileName := filepath.Join(t.TempDir(), "bad.asm")
+	if err := os.WriteFile(fileName, []byte("\tCONST R0, #5\n\tCONST R9, #1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Load(fileName)
+
+	if machine.Lc4.Mem[0x0000] != 0 || len(machine.Lc4.Files) != 0 {
+		t.Error("Expected nothing to be loaded from a file with errors")
+	}
+}
@@ -0,0 +1,246 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"strconv"
+	"strings"
+)
+
+// Eval evaluates an address or value expression. Operands are labels,
+// registers (R0-R7, SP, FP, RA), PC and PSR, memory dereferences such as
+// [R6-1], and literals in Go (0x4000, 0b101, -5) or LC4 (x4000, #-5) syntax.
+// Operators follow C precedence: unary - ~ +, then * / %, + -, << >>, &, ^, |.
+// The result wraps to 16 bits.
+func Eval(expr string) (uint16, error) {
+	p := &exprParser{src: expr}
+	p.next()
+	if p.tok == "" {
+		return 0, fmt.Errorf("empty expression")
+	}
+
+	val, err := p.parseBinary(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.tok != "" {
+		return 0, p.errorf("unexpected %q", p.tok)
+	}
+	return uint16(val), nil
+}
+
+// binary operators, from lowest to highest precedence
+var exprPrecedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type exprParser struct {
+	src    string
+	pos    int
+	tok    string
+	tokPos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at column %d of %q", fmt.Sprintf(format, args...), p.tokPos+1, p.src)
+}
+
+// next advances to the next token, leaving tok empty at the end of input
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+
+	start := p.pos
+	char := p.src[p.pos]
+	switch {
+	case isIdentChar(char) || char == '#':
+		p.pos++
+		if char == '#' && p.pos < len(p.src) && p.src[p.pos] == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+			p.pos++
+		}
+	case strings.HasPrefix(p.src[p.pos:], "<<") || strings.HasPrefix(p.src[p.pos:], ">>"):
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isIdentChar(char byte) bool {
+	return char == '_' || char == '.' ||
+		('0' <= char && char <= '9') ||
+		('a' <= char && char <= 'z') ||
+		('A' <= char && char <= 'Z')
+}
+
+func (p *exprParser) parseBinary(level int) (int32, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+
+	lhs, err := p.parseBinary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := p.tok
+		if !containsString(exprPrecedence[level], op) {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.parseBinary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+
+		switch op {
+		case "|":
+			lhs |= rhs
+		case "^":
+			lhs ^= rhs
+		case "&":
+			lhs &= rhs
+		case "<<":
+			lhs = int32(uint16(lhs) << uint16(rhs))
+		case ">>":
+			lhs = int32(uint16(lhs) >> uint16(rhs))
+		case "+":
+			lhs += rhs
+		case "-":
+			lhs -= rhs
+		case "*":
+			lhs *= rhs
+		case "/", "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero in %q", p.src)
+			}
+			if op == "/" {
+				lhs /= rhs
+			} else {
+				lhs %= rhs
+			}
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (int32, error) {
+	switch p.tok {
+	case "-", "~", "+":
+		op := p.tok
+		p.next()
+		val, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+
+		if op == "-" {
+			return -val, nil
+		} else if op == "~" {
+			return ^val, nil
+		}
+		return val, nil
+	}
+
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (int32, error) {
+	tok := p.tok
+	switch tok {
+	case "":
+		return 0, p.errorf("unexpected end of expression")
+	case "(", "[":
+		closing := map[string]string{"(": ")", "[": "]"}[tok]
+		p.next()
+		val, err := p.parseBinary(0)
+		if err != nil {
+			return 0, err
+		}
+		if p.tok != closing {
+			return 0, p.errorf("missing %s", closing)
+		}
+		p.next()
+
+		if tok == "[" {
+			return int32(machine.Lc4.Mem[uint16(val)]), nil
+		}
+		return val, nil
+	}
+
+	if !isIdentChar(tok[0]) && tok[0] != '#' {
+		return 0, p.errorf("unexpected %q", tok)
+	}
+
+	val, err := evalSymbol(tok)
+	if err != nil {
+		return 0, p.errorf("%s", err)
+	}
+	p.next()
+	return val, nil
+}
+
+// evalSymbol looks up a register, label or literal
+func evalSymbol(tok string) (int32, error) {
+	if reg, err := ParseReg(tok); err == nil {
+		return int32(machine.Lc4.Reg[reg]), nil
+	}
+
+	switch strings.ToUpper(tok) {
+	case "PC":
+		return int32(machine.Lc4.Pc), nil
+	case "PSR":
+		return int32(machine.Lc4.Psr), nil
+	}
+
+	if addr, exists := machine.Lc4.Labels[tok]; exists {
+		return int32(addr), nil
+	}
+
+	// LC4 literals
+	var val int64
+	var err error
+	if strings.HasPrefix(tok, "#") {
+		val, err = strconv.ParseInt(tok[1:], 10, 32)
+	} else if len(tok) > 1 && (tok[0] == 'x' || tok[0] == 'X') {
+		val, err = strconv.ParseInt(tok[1:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("no symbol %q", tok)
+		}
+	} else if '0' <= tok[0] && tok[0] <= '9' {
+		val, err = strconv.ParseInt(tok, 0, 32)
+	} else {
+		return 0, fmt.Errorf("no symbol %q", tok)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", tok)
+	} else if val < -0x8000 || val > 0xFFFF {
+		return 0, fmt.Errorf("number %q does not fit in 16 bits", tok)
+	}
+	return int32(val), nil
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
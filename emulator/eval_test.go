@@ -0,0 +1,51 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	loadCallProgram()
+	machine.Lc4.Reg[1] = 0x0005
+	machine.Lc4.Reg[6] = 0x0011
+	machine.Lc4.Reg[7] = 0x0001
+
+	expected := map[string]uint16{
+		"SUB":           0x0010,
+		"SUB+3":         0x0013,
+		"R1 * 2 + 1":    0x000B,
+		"R1 * (2 + 1)":  0x000F,
+		"SP":            0x0011,
+		"RA":            0x0001,
+		"[SP]":          0xF020,
+		"[SUB + 3]":     0xC1C0,
+		"x4000":         0x4000,
+		"#-5":           0xFFFB,
+		"-1":            0xFFFF,
+		"0b101 | 0x10":  0x0015,
+		"1 << 4 >> 2":   0x0004,
+		"~0 ^ 0xFF":     0xFF00,
+		"PC":            0x0000,
+		"MAIN + R1 % 3": 0x0002,
+	}
+
+	for expr, val := range expected {
+		actual, err := Eval(expr)
+		if err != nil {
+			t.Error("Evaluating", expr, "failed:", err)
+		} else if actual != val {
+			t.Errorf("Evaluating %s: expected 0x%04X but got 0x%04X", expr, val, actual)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	loadCallProgram()
+
+	for _, expr := range []string{"", "FOO", "SUB +", "[R1", "(1 + 2", "1 / 0", "0x10000", "R1 R2", "#abc"} {
+		if _, err := Eval(expr); err == nil {
+			t.Error("Expected an error evaluating", expr)
+		}
+	}
+}
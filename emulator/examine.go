@@ -0,0 +1,115 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"strconv"
+	"strings"
+)
+
+var examineAddr uint16
+var examineCount = 1
+var examineFmt byte = 'x'
+
+// Examine dumps memory starting at strAddr. spec is the optional /<count><fmt>
+// suffix of the command. Without an address, it continues from where the last
+// examine left off.
+func Examine(spec string, strAddr string) {
+	count, format, ok := parseExamineSpec(spec)
+	if !ok {
+		return
+	}
+
+	if strAddr != "" {
+		addr, err := parseAddr(strAddr)
+		if err != nil {
+			fmt.Println("Invalid address:", err)
+			return
+		}
+		examineAddr = addr
+	}
+	examineCount = count
+	examineFmt = format
+
+	examineAddr = dumpMem(examineAddr, count, format)
+}
+
+// parseExamineSpec reads /<count><fmt>, defaulting to the last count and format
+func parseExamineSpec(spec string) (count int, format byte, ok bool) {
+	count = examineCount
+	format = examineFmt
+
+	spec = strings.TrimPrefix(spec, "/")
+	digits := 0
+	for digits < len(spec) && '0' <= spec[digits] && spec[digits] <= '9' {
+		digits++
+	}
+
+	if digits > 0 {
+		var err error
+		count, err = strconv.Atoi(spec[:digits])
+		if err != nil || count <= 0 {
+			fmt.Println("Invalid count:", spec[:digits])
+			return
+		}
+	}
+
+	switch rest := spec[digits:]; len(rest) {
+	case 0:
+	case 1:
+		format = rest[0]
+	default:
+		fmt.Println("Invalid format:", rest)
+		return
+	}
+
+	if !strings.ContainsRune("xdutci", rune(format)) {
+		fmt.Println("Invalid format:", string(format))
+		return
+	}
+	return count, format, true
+}
+
+// dumpMem prints count words starting at addr and returns the address after
+// the last word printed
+func dumpMem(addr uint16, count int, format byte) uint16 {
+	perRow := map[byte]int{'x': 8, 'd': 8, 'u': 8, 't': 4, 'c': 8, 'i': 1}[format]
+
+	row := []string{}
+	rowAddr := addr
+	for i := 0; i < count; i++ {
+		// start a new row when the row is full or a label is reached
+		labeled := machine.Lc4.Meta[addr].Label != ""
+		if len(row) == perRow || (len(row) > 0 && labeled) {
+			fmt.Printf("%s:\t%s\n", formatAddr(rowAddr), strings.Join(row, "\t"))
+			row = row[:0]
+		}
+		if len(row) == 0 {
+			rowAddr = addr
+		}
+
+		row = append(row, formatWord(addr, format))
+		addr++
+	}
+
+	if len(row) > 0 {
+		fmt.Printf("%s:\t%s\n", formatAddr(rowAddr), strings.Join(row, "\t"))
+	}
+	return addr
+}
+
+func formatWord(addr uint16, format byte) string {
+	if format == 'i' {
+		return disassemble(addr)
+	}
+	return formatValue(machine.Lc4.Mem[addr], format)
+}
+
+// disassemble formats the instruction at addr, annotated with its target
+func disassemble(addr uint16) string {
+	insn := machine.Decode(addr)
+	if target, ok := insn.Target(addr); ok {
+		return fmt.Sprintf("%s\t; %s", insn.Asm(), formatAddr(target))
+	}
+	return insn.Asm()
+}
@@ -0,0 +1,54 @@
+package emulator
+
+import (
+	"testing"
+)
+
+func TestParseExamineSpec(t *testing.T) {
+	examineCount = 1
+	examineFmt = 'x'
+
+	count, format, ok := parseExamineSpec("/4i")
+	if !ok || count != 4 || format != 'i' {
+		t.Error("Expected 4 words in format i, but got", count, string(format))
+	}
+
+	// count and format default to the last ones used
+	examineCount = count
+	examineFmt = format
+	count, format, ok = parseExamineSpec("/c")
+	if !ok || count != 4 || format != 'c' {
+		t.Error("Expected 4 words in format c, but got", count, string(format))
+	}
+
+	if _, _, ok = parseExamineSpec("/4q"); ok {
+		t.Error("Expected an error for format q")
+	}
+}
+
+func TestExamineContinues(t *testing.T) {
+	loadCallProgram()
+	Examine("/2x", "SUB")
+	Examine("", "")
+
+	if examineAddr != 0x0014 {
+		t.Errorf("Expected the next address to be 0x0014, but got 0x%04X", examineAddr)
+	}
+}
+
+func TestFormatWord(t *testing.T) {
+	loadCallProgram()
+	expected := map[byte]string{
+		'x': "0xC1C0",
+		'd': "-15936",
+		'u': "49600",
+		't': "0b1100000111000000",
+		'i': "JMPR R7",
+	}
+
+	for format, str := range expected {
+		if actual := formatWord(0x0013, format); actual != str {
+			t.Errorf("Format %c: expected %s but got %s", format, str, actual)
+		}
+	}
+}
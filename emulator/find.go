@@ -0,0 +1,94 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"strconv"
+	"strings"
+)
+
+// Find searches memory between strStart and strEnd, inclusive, for a word,
+// a sequence of words, or a quoted string. Strings are matched as LC4 stores
+// them, one char per word followed by a null terminator. A ? in a sequence
+// matches any word.
+func Find(strStart string, strEnd string, strPattern []string) {
+	start, err := parseAddr(strStart)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+	end, err := parseAddr(strEnd)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+	if end < start {
+		fmt.Println("Invalid range: end address is before start address")
+		return
+	}
+
+	pattern, wildcard, ok := parsePattern(strPattern)
+	if !ok {
+		return
+	}
+	if len(pattern) == 0 {
+		fmt.Println("Empty search pattern")
+		return
+	}
+
+	found := 0
+	for addr := int(start); addr+len(pattern)-1 <= int(end); addr++ {
+		if matchPattern(uint16(addr), pattern, wildcard) {
+			fmt.Println(formatAddr(uint16(addr)))
+			found++
+		}
+	}
+
+	if found == 1 {
+		fmt.Println("1 pattern found.")
+	} else if found > 1 {
+		fmt.Printf("%d patterns found.\n", found)
+	} else {
+		fmt.Println("Pattern not found.")
+	}
+}
+
+func parsePattern(strPattern []string) (pattern []uint16, wildcard []bool, ok bool) {
+	for _, str := range strPattern {
+		if strings.HasPrefix(str, "\"") {
+			unquoted, err := strconv.Unquote(str)
+			if err != nil {
+				fmt.Println("Invalid string:", str)
+				return nil, nil, false
+			}
+
+			for _, char := range unquoted {
+				pattern = append(pattern, uint16(char))
+				wildcard = append(wildcard, false)
+			}
+			pattern = append(pattern, 0)
+			wildcard = append(wildcard, false)
+		} else if str == "?" {
+			pattern = append(pattern, 0)
+			wildcard = append(wildcard, true)
+		} else {
+			val, err := parseValue(str)
+			if err != nil {
+				fmt.Println("Invalid value:", err)
+				return nil, nil, false
+			}
+			pattern = append(pattern, val)
+			wildcard = append(wildcard, false)
+		}
+	}
+	return pattern, wildcard, true
+}
+
+func matchPattern(addr uint16, pattern []uint16, wildcard []bool) bool {
+	for i, val := range pattern {
+		if !wildcard[i] && machine.Lc4.Mem[addr+uint16(i)] != val {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestParsePatternString(t *testing.T) {
+	pattern, wildcard, ok := parsePattern([]string{"\"Hi\"", "?", "0x5"})
+	expected := []uint16{'H', 'i', 0, 0, 5}
+
+	if !ok || len(pattern) != len(expected) {
+		t.Fatal("Expected", expected, "but got", pattern)
+	}
+	for i := range expected {
+		if pattern[i] != expected[i] {
+			t.Error("Expected", expected, "but got", pattern)
+		}
+	}
+	if !wildcard[3] || wildcard[4] {
+		t.Error("Expected only the ? to be a wildcard, but got", wildcard)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	loadCallProgram()
+	machine.Lc4.Mem[0x2000] = 'o'
+	machine.Lc4.Mem[0x2001] = 'k'
+	machine.Lc4.Mem[0x2002] = 0
+
+	pattern, wildcard, _ := parsePattern([]string{"\"ok\""})
+	if !matchPattern(0x2000, pattern, wildcard) {
+		t.Error("Expected the string to match at 0x2000")
+	}
+	if matchPattern(0x2001, pattern, wildcard) {
+		t.Error("Expected the string not to match at 0x2001")
+	}
+}
@@ -0,0 +1,125 @@
+package emulator
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"strconv"
+	"strings"
+)
+
+func SetReg(strReg string, strVal string) {
+	reg, err := ParseReg(strReg)
+	if err != nil {
+		fmt.Println("Invalid register:", strReg)
+		return
+	}
+
+	val, err := parseValue(strVal)
+	if err != nil {
+		fmt.Println("Invalid value:", err)
+		return
+	}
+
+	machine.Lc4.Reg[reg] = val
+	fmt.Printf("\tR%d: %016b / 0x%04X\n", reg, val, val)
+}
+
+func SetMem(strAddr string, strVal string) {
+	addr, err := parseAddr(strAddr)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+
+	val, err := parseValue(strVal)
+	if err != nil {
+		fmt.Println("Invalid value:", err)
+		return
+	}
+
+	machine.Lc4.Mem[addr] = val
+	PrintMem(strAddr)
+}
+
+func SetPc(strAddr string) {
+	addr, err := parseAddr(strAddr)
+	if err != nil {
+		fmt.Println("Invalid address:", err)
+		return
+	}
+
+	machine.Lc4.Pc = addr
+	PrintCode()
+}
+
+// SetPsr sets the whole PSR, or only the privilege bit if field is "priv"
+func SetPsr(field string, strVal string) {
+	val, err := parseValue(strVal)
+	if err != nil {
+		fmt.Println("Invalid value:", err)
+		return
+	}
+
+	switch field {
+	case "":
+		machine.Lc4.Psr = val
+	case "priv":
+		if val > 1 {
+			fmt.Println("Invalid privilege bit:", strVal)
+			return
+		}
+		machine.Lc4.Psr = (machine.Lc4.Psr & 0x7FFF) | (val << 15)
+	default:
+		fmt.Println("Invalid PSR field:", field)
+		return
+	}
+
+	PrintPsr()
+}
+
+// SetNzp sets exactly one of the n, z and p condition codes
+func SetNzp(flag string) {
+	var bits uint16
+	switch strings.ToLower(flag) {
+	case "n":
+		bits = 0b100
+	case "z":
+		bits = 0b010
+	case "p":
+		bits = 0b001
+	default:
+		fmt.Println("Invalid condition code:", flag)
+		return
+	}
+
+	machine.Lc4.Psr = (machine.Lc4.Psr & 0xFFF8) | bits
+	PrintPsr()
+}
+
+// ParseReg reads a register name such as R1 or r1, or one of the aliases SP
+// (R6), FP (R5) and RA (R7)
+func ParseReg(strReg string) (uint16, error) {
+	switch strings.ToUpper(strReg) {
+	case "SP":
+		return 6, nil
+	case "FP":
+		return 5, nil
+	case "RA":
+		return 7, nil
+	}
+
+	if len(strReg) != 2 || (strReg[0] != 'R' && strReg[0] != 'r') {
+		return 0, fmt.Errorf("invalid register %q", strReg)
+	}
+
+	reg, err := strconv.ParseUint(strReg[1:], 10, 16)
+	if err != nil || reg >= machine.NUM_REGS {
+		return 0, fmt.Errorf("invalid register %q", strReg)
+	}
+	return uint16(reg), nil
+}
+
+// parseValue evaluates a value expression, see Eval
+func parseValue(strVal string) (uint16, error) {
+	return Eval(strVal)
+}
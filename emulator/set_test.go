@@ -0,0 +1,40 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestSetRegAndMem(t *testing.T) {
+	loadCallProgram()
+	SetReg("R1", "-1")
+	SetMem("SUB", "0x1234")
+
+	if machine.Lc4.Reg[1] != 0xFFFF {
+		t.Errorf("Expected R1 = 0xFFFF, but got 0x%04X", machine.Lc4.Reg[1])
+	}
+	if machine.Lc4.Mem[0x0010] != 0x1234 {
+		t.Errorf("Expected [SUB] = 0x1234, but got 0x%04X", machine.Lc4.Mem[0x0010])
+	}
+}
+
+func TestSetPsr(t *testing.T) {
+	loadCallProgram()
+	SetPsr("priv", "0")
+	SetNzp("n")
+
+	if machine.Lc4.Psr != 0x0004 {
+		t.Errorf("Expected PSR = 0x0004, but got 0x%04X", machine.Lc4.Psr)
+	}
+	if machine.Nzp() != -1 {
+		t.Error("Expected Nzp = -1, but got", machine.Nzp())
+	}
+}
+
+func TestParseRegRejectsInvalid(t *testing.T) {
+	for _, strReg := range []string{"R8", "X1", "R", "R10"} {
+		if _, err := ParseReg(strReg); err == nil {
+			t.Error("Expected an error for register", strReg)
+		}
+	}
+}
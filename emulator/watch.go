@@ -0,0 +1,75 @@
+package emulator
+
+import (
+	"fmt"
+)
+
+// SetWatchpoint sets a watchpoint that stops execution whenever the value of
+// an expression changes
+func SetWatchpoint(expr string) {
+	val, err := Eval(expr)
+	if err != nil {
+		fmt.Println("Invalid expression:", err)
+		return
+	}
+
+	bp := &Breakpoint{
+		Num:     nextBreakpointNum,
+		Enabled: true,
+		Watch:   true,
+		Expr:    expr,
+		Value:   val,
+	}
+	breakpoints = append(breakpoints, bp)
+	nextBreakpointNum++
+	fmt.Printf("Watchpoint %d: %s\n", bp.Num, expr)
+}
+
+// checkWatchpoints evaluates every enabled watchpoint, counting a hit for each
+// whose value changed, and returns the first that should stop execution
+func checkWatchpoints() (hit *Breakpoint) {
+	for _, bp := range breakpoints {
+		if !bp.Watch || !bp.Enabled {
+			continue
+		}
+
+		// an expression such as [R1] can fail partway through a program, and
+		// is checked again after the next instruction
+		val, err := Eval(bp.Expr)
+		if err != nil || val == bp.Value {
+			continue
+		}
+		bp.OldValue, bp.Value = bp.Value, val
+
+		bp.Hits++
+		if bp.Ignore > 0 {
+			bp.Ignore--
+			continue
+		}
+		if hit == nil {
+			hit = bp
+		}
+	}
+	return
+}
+
+// syncWatchpoints takes the current value of every watchpoint, so that only
+// changes made by running instructions stop execution, not ones made with set
+func syncWatchpoints() {
+	for _, bp := range breakpoints {
+		if val, err := Eval(bp.Expr); bp.Watch && err == nil {
+			bp.Value = val
+		}
+	}
+}
+
+// checkStop checks the watchpoints and then the breakpoints at addr, and
+// returns the one that should stop execution, if any. Watchpoints are always
+// checked so that their values stay current.
+func checkStop(addr uint16) *Breakpoint {
+	watch := checkWatchpoints()
+	if bp := checkBreakpoints(addr); bp != nil {
+		return bp
+	}
+	return watch
+}
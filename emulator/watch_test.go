@@ -0,0 +1,36 @@
+package emulator
+
+import (
+	"github.com/hryoma/lc4go/machine"
+	"testing"
+)
+
+func TestWatchpointStopsOnChange(t *testing.T) {
+	loadCallProgram()
+	SetWatchpoint("R5 + 1")
+
+	// SUB's first instruction copies RA, which JSR set to 1, into R5
+	stop := Resume()
+	bp := stop.Breakpoint
+	if stop.Reason != StopBreakpoint || bp == nil || !bp.Watch {
+		t.Fatal("Expected to stop at the watchpoint but got", stop)
+	}
+	if machine.Lc4.Pc != 0x0011 || bp.OldValue != 1 || bp.Value != 2 || bp.Hits != 1 {
+		t.Errorf("Unexpected stop at 0x%04X, from %d to %d", machine.Lc4.Pc, bp.OldValue, bp.Value)
+	}
+
+	// changes made between runs don't count
+	machine.Lc4.Reg[5] = 7
+	Step(1)
+	if stopBreakpoint != nil || bp.Hits != 1 {
+		t.Error("Expected setting R5 not to trigger the watchpoint")
+	}
+}
+
+func TestWatchpointInvalidExpr(t *testing.T) {
+	loadCallProgram()
+	SetWatchpoint("NOWHERE")
+	if len(breakpoints) != 0 {
+		t.Error("Expected no watchpoint for an invalid expression")
+	}
+}
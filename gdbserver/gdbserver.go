@@ -0,0 +1,487 @@
+// Package gdbserver exposes the LC4 machine over the GDB Remote Serial
+// Protocol.
+//
+// LC4 memory is word addressed, and so is the server: every address in a
+// packet, including the pc and breakpoint addresses, is a word address. Memory
+// packets still count bytes, two per word, most significant byte first. The
+// registers are r0-r7, pc and psr, each 16 bits and sent most significant byte
+// first.
+package gdbserver
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const NUM_GDB_REGS = machine.NUM_REGS + 2
+const GDB_PC_REG = machine.NUM_REGS
+const GDB_PSR_REG = machine.NUM_REGS + 1
+const PACKET_SIZE = 0x4000
+
+const SIGINT = 2
+const SIGILL = 4
+const SIGTRAP = 5
+
+const targetXml = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.lc4go.lc4.core">
+    <reg name="r0" bitsize="16" type="int" regnum="0"/>
+    <reg name="r1" bitsize="16" type="int"/>
+    <reg name="r2" bitsize="16" type="int"/>
+    <reg name="r3" bitsize="16" type="int"/>
+    <reg name="r4" bitsize="16" type="int"/>
+    <reg name="r5" bitsize="16" type="data_ptr"/>
+    <reg name="r6" bitsize="16" type="data_ptr"/>
+    <reg name="r7" bitsize="16" type="code_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="psr" bitsize="16" type="int"/>
+  </feature>
+</target>
+`
+
+type watchKind int
+
+const (
+	watchWrite  watchKind = 2
+	watchRead   watchKind = 3
+	watchAccess watchKind = 4
+)
+
+func (kind watchKind) String() string {
+	return map[watchKind]string{
+		watchWrite:  "watch",
+		watchRead:   "rwatch",
+		watchAccess: "awatch",
+	}[kind]
+}
+
+type Server struct {
+	conn        io.ReadWriter
+	writeLock   sync.Mutex
+	noAck       bool
+	breakpoints map[uint16]bool
+	watchpoints map[uint16]watchKind
+	packets     chan string
+	interrupts  chan struct{}
+}
+
+// ListenAndServe accepts GDB connections on addr, one at a time, until a
+// client kills the target
+func ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	fmt.Println("Listening for GDB on", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("GDB connected from", conn.RemoteAddr())
+		killed := NewServer(conn).Serve()
+		conn.Close()
+		if killed {
+			return nil
+		}
+		fmt.Println("GDB disconnected")
+	}
+}
+
+func NewServer(conn io.ReadWriter) *Server {
+	return &Server{
+		conn:        conn,
+		breakpoints: map[uint16]bool{},
+		watchpoints: map[uint16]watchKind{},
+		packets:     make(chan string),
+		interrupts:  make(chan struct{}, 1),
+	}
+}
+
+// Serve answers packets until the client detaches or disconnects, and reports
+// whether the client killed the target
+func (s *Server) Serve() (killed bool) {
+	go s.readPackets()
+
+	for packet := range s.packets {
+		switch packet {
+		case "k":
+			return true
+		case "D":
+			s.send("OK")
+			return false
+		}
+
+		s.send(s.handle(packet))
+	}
+	return false
+}
+
+// readPackets decodes packets and interrupts from the connection until it
+// closes
+func (s *Server) readPackets() {
+	defer close(s.packets)
+	reader := bufio.NewReader(s.conn)
+
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch char {
+		case 0x03:
+			select {
+			case s.interrupts <- struct{}{}:
+			default:
+			}
+		case '$':
+			data, err := reader.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+
+			checksum := make([]byte, 2)
+			if _, err := io.ReadFull(reader, checksum); err != nil {
+				return
+			}
+
+			if expected, err := strconv.ParseUint(string(checksum), 16, 8); err != nil || byte(expected) != sum(data) {
+				s.write("-")
+				continue
+			}
+			if !s.noAck {
+				s.write("+")
+			}
+			s.packets <- unescape(data)
+		}
+	}
+}
+
+func (s *Server) send(data string) {
+	s.write(fmt.Sprintf("$%s#%02x", data, sum(data)))
+}
+
+func (s *Server) write(data string) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	io.WriteString(s.conn, data)
+}
+
+func sum(data string) (checksum byte) {
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+	return
+}
+
+// unescape undoes the }-escaping used for binary data
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out.WriteByte(data[i] ^ 0x20)
+		} else {
+			out.WriteByte(data[i])
+		}
+	}
+	return out.String()
+}
+
+// handle returns the reply to a packet, or an empty reply if it is unsupported
+func (s *Server) handle(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+", PACKET_SIZE)
+	case packet == "QStartNoAckMode":
+		s.noAck = true
+		return "OK"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return readXfer(targetXml, strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+	case packet == "?":
+		return fmt.Sprintf("S%02x", SIGTRAP)
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	case packet == "qSymbol::":
+		return "OK"
+	case strings.HasPrefix(packet, "H"), strings.HasPrefix(packet, "T"):
+		return "OK"
+	case packet == "vCont?":
+		return "vCont;c;C;s;S"
+	case strings.HasPrefix(packet, "vCont;") && len(packet) > len("vCont;"):
+		action := packet[len("vCont;")]
+		return s.resume(action == 's' || action == 'S')
+	case packet == "g":
+		return readRegs()
+	case strings.HasPrefix(packet, "G"):
+		return writeRegs(packet[1:])
+	case strings.HasPrefix(packet, "p"):
+		return readReg(packet[1:])
+	case strings.HasPrefix(packet, "P"):
+		return writeReg(packet[1:])
+	case strings.HasPrefix(packet, "m"):
+		return readMem(packet[1:])
+	case strings.HasPrefix(packet, "M"):
+		return writeMem(packet[1:])
+	case strings.HasPrefix(packet, "c"), strings.HasPrefix(packet, "s"):
+		if len(packet) > 1 {
+			addr, err := strconv.ParseUint(packet[1:], 16, 16)
+			if err != nil {
+				return "E01"
+			}
+			machine.Lc4.Pc = uint16(addr)
+		}
+		return s.resume(packet[0] == 's')
+	case strings.HasPrefix(packet, "Z"), strings.HasPrefix(packet, "z"):
+		return s.setPoint(packet[0] == 'Z', packet[1:])
+	}
+	return ""
+}
+
+func readXfer(doc string, args string) string {
+	strOffset, strLength, found := strings.Cut(args, ",")
+	offset, err1 := strconv.ParseUint(strOffset, 16, 32)
+	length, err2 := strconv.ParseUint(strLength, 16, 32)
+	if !found || err1 != nil || err2 != nil {
+		return "E01"
+	}
+
+	if offset >= uint64(len(doc)) {
+		return "l"
+	} else if offset+length >= uint64(len(doc)) {
+		return "l" + doc[offset:]
+	}
+	return "m" + doc[offset:offset+length]
+}
+
+func getReg(n int) uint16 {
+	switch n {
+	case GDB_PC_REG:
+		return machine.Lc4.Pc
+	case GDB_PSR_REG:
+		return machine.Lc4.Psr
+	}
+	return machine.Lc4.Reg[n]
+}
+
+func setReg(n int, val uint16) {
+	switch n {
+	case GDB_PC_REG:
+		machine.Lc4.Pc = val
+	case GDB_PSR_REG:
+		machine.Lc4.Psr = val
+	default:
+		machine.Lc4.Reg[n] = val
+	}
+}
+
+func readRegs() string {
+	var out strings.Builder
+	for n := 0; n < NUM_GDB_REGS; n++ {
+		fmt.Fprintf(&out, "%04x", getReg(n))
+	}
+	return out.String()
+}
+
+func writeRegs(data string) string {
+	if len(data) != NUM_GDB_REGS*4 {
+		return "E01"
+	}
+
+	for n := 0; n < NUM_GDB_REGS; n++ {
+		val, err := strconv.ParseUint(data[n*4:n*4+4], 16, 16)
+		if err != nil {
+			return "E01"
+		}
+		setReg(n, uint16(val))
+	}
+	return "OK"
+}
+
+func readReg(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil || n >= NUM_GDB_REGS {
+		return "E01"
+	}
+	return fmt.Sprintf("%04x", getReg(int(n)))
+}
+
+func writeReg(args string) string {
+	strReg, strVal, found := strings.Cut(args, "=")
+	n, err1 := strconv.ParseUint(strReg, 16, 8)
+	val, err2 := strconv.ParseUint(strVal, 16, 16)
+	if !found || err1 != nil || err2 != nil || n >= NUM_GDB_REGS {
+		return "E01"
+	}
+
+	setReg(int(n), uint16(val))
+	return "OK"
+}
+
+// parseRange reads the addr,length arguments of memory packets
+func parseRange(args string) (addr uint16, length int, err error) {
+	strAddr, strLength, found := strings.Cut(args, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("missing length")
+	}
+
+	addr64, err := strconv.ParseUint(strAddr, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length64, err := strconv.ParseUint(strLength, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(addr64), int(length64), nil
+}
+
+func readMem(args string) string {
+	addr, length, err := parseRange(args)
+	if err != nil || length > PACKET_SIZE/2 {
+		return "E01"
+	}
+
+	bytes := make([]byte, length)
+	for i := range bytes {
+		word := machine.Lc4.Mem[addr+uint16(i/2)]
+		if i%2 == 0 {
+			bytes[i] = byte(word >> 8)
+		} else {
+			bytes[i] = byte(word)
+		}
+	}
+	return hex.EncodeToString(bytes)
+}
+
+func writeMem(args string) string {
+	strRange, strData, found := strings.Cut(args, ":")
+	addr, length, err := parseRange(strRange)
+	if !found || err != nil {
+		return "E01"
+	}
+
+	bytes, err := hex.DecodeString(strData)
+	if err != nil || len(bytes) != length {
+		return "E01"
+	}
+
+	for i, b := range bytes {
+		word := &machine.Lc4.Mem[addr+uint16(i/2)]
+		if i%2 == 0 {
+			*word = (*word & 0x00FF) | (uint16(b) << 8)
+		} else {
+			*word = (*word & 0xFF00) | uint16(b)
+		}
+	}
+	return "OK"
+}
+
+// setPoint inserts or removes a breakpoint (types 0 and 1) or a watchpoint
+// (types 2, 3 and 4). For watchpoints, kind is the length in bytes.
+func (s *Server) setPoint(insert bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 {
+		return "E01"
+	}
+	addr, err1 := strconv.ParseUint(fields[1], 16, 16)
+	kind, err2 := strconv.ParseUint(fields[2], 16, 16)
+	if err1 != nil || err2 != nil {
+		return "E01"
+	}
+
+	switch fields[0] {
+	case "0", "1":
+		if insert {
+			s.breakpoints[uint16(addr)] = true
+		} else {
+			delete(s.breakpoints, uint16(addr))
+		}
+	case "2", "3", "4":
+		pointType, _ := strconv.Atoi(fields[0])
+		words := (kind + 1) / 2
+		if words == 0 {
+			words = 1
+		}
+
+		for i := uint16(0); i < uint16(words); i++ {
+			if insert {
+				s.watchpoints[uint16(addr)+i] = watchKind(pointType)
+			} else {
+				delete(s.watchpoints, uint16(addr)+i)
+			}
+		}
+	default:
+		return ""
+	}
+	return "OK"
+}
+
+// resume executes until the next stop and returns the stop reply
+func (s *Server) resume(step bool) string {
+	// drop any interrupt that arrived while the target was already stopped
+	select {
+	case <-s.interrupts:
+	default:
+	}
+
+	for {
+		insn := machine.Decode(machine.Lc4.Pc)
+		dataAddr, accessesData := insn.DataAddr()
+		isWrite := insn.OpName == machine.OpSTR
+		// a store that fails the privilege check never touches memory
+		if isWrite && !machine.Writable(dataAddr) {
+			accessesData = false
+		}
+
+		switch err := emulator.Exec(); err {
+		case nil:
+		case emulator.ErrHalted:
+			return "W00"
+		default:
+			return fmt.Sprintf("S%02x", SIGILL)
+		}
+
+		if kind, watched := s.watchpoints[dataAddr]; accessesData && watched {
+			if kind == watchAccess || (kind == watchWrite) == isWrite {
+				return fmt.Sprintf("T%02x%s:%x;", SIGTRAP, kind, dataAddr)
+			}
+		}
+
+		if step {
+			return fmt.Sprintf("S%02x", SIGTRAP)
+		} else if s.breakpoints[machine.Lc4.Pc] {
+			return fmt.Sprintf("T%02xswbreak:;", SIGTRAP)
+		}
+
+		select {
+		case <-s.interrupts:
+			return fmt.Sprintf("S%02x", SIGINT)
+		default:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gdbserver
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"net"
+	"strings"
+	"testing"
+)
+
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startServer(t *testing.T) *client {
+	emulator.Clear()
+	machine.Lc4.Pc = 0x0000
+	machine.Lc4.Psr = 0
+
+	// 0x0000: CONST R1, #3
+	// 0x0001: STR R1, R2, #0
+	// 0x0002: ADD R1, R1, #-1
+	// 0x0003: BRp #-2
+	// 0x0004: TRAP xFF
+	machine.Lc4.Mem[0x0000] = 0x9203
+	machine.Lc4.Mem[0x0001] = 0x7280
+	machine.Lc4.Mem[0x0002] = 0x127F
+	machine.Lc4.Mem[0x0003] = 0x03FD
+	machine.Lc4.Mem[0x0004] = 0xF0FF
+	machine.Lc4.Reg[2] = 0x4000
+
+	serverConn, clientConn := net.Pipe()
+	go NewServer(serverConn).Serve()
+	t.Cleanup(func() {
+		clientConn.Close()
+	})
+
+	return &client{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+// request sends a packet and returns the reply, handling acks
+func (c *client) request(t *testing.T, data string) string {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	fmt.Fprintf(c.conn, "$%s#%02x", data, sum)
+
+	if ack, err := c.reader.ReadByte(); err != nil || ack != '+' {
+		t.Fatalf("Expected + for %s, but got %q (%v)", data, ack, err)
+	}
+	if start, err := c.reader.ReadByte(); err != nil || start != '$' {
+		t.Fatalf("Expected a reply to %s, but got %q (%v)", data, start, err)
+	}
+	reply, err := c.reader.ReadString('#')
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.reader.Discard(2)
+	c.conn.Write([]byte("+"))
+
+	return strings.TrimSuffix(reply, "#")
+}
+
+func TestRegisters(t *testing.T) {
+	c := startServer(t)
+
+	if reply := c.request(t, "g"); reply != "0000000040000000000000000000000000000000" {
+		t.Error("Unexpected register dump:", reply)
+	}
+	if reply := c.request(t, "P3=beef"); reply != "OK" {
+		t.Error("Expected OK writing r3, but got", reply)
+	}
+	if reply := c.request(t, "p3"); reply != "beef" {
+		t.Error("Expected r3 = beef, but got", reply)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	c := startServer(t)
+
+	if reply := c.request(t, "m0,4"); reply != "92037280" {
+		t.Error("Unexpected memory dump:", reply)
+	}
+	if reply := c.request(t, "M2000,3:123456"); reply != "OK" {
+		t.Error("Expected OK writing memory, but got", reply)
+	}
+	if machine.Lc4.Mem[0x2000] != 0x1234 || machine.Lc4.Mem[0x2001] != 0x5600 {
+		t.Errorf("Unexpected memory after write: 0x%04X 0x%04X", machine.Lc4.Mem[0x2000], machine.Lc4.Mem[0x2001])
+	}
+}
+
+func TestStepAndBreakpoint(t *testing.T) {
+	c := startServer(t)
+
+	if reply := c.request(t, "s"); reply != "S05" || machine.Lc4.Pc != 0x0001 {
+		t.Errorf("Expected S05 at 0x0001, but got %s at 0x%04X", reply, machine.Lc4.Pc)
+	}
+
+	c.request(t, "Z0,3,2")
+	if reply := c.request(t, "c"); reply != "T05swbreak:;" || machine.Lc4.Pc != 0x0003 {
+		t.Errorf("Expected T05swbreak:; at 0x0003, but got %s at 0x%04X", reply, machine.Lc4.Pc)
+	}
+
+	c.request(t, "z0,3,2")
+	if reply := c.request(t, "c"); reply != "W00" {
+		t.Error("Expected W00, but got", reply)
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	c := startServer(t)
+
+	c.request(t, "Z2,4000,2")
+	if reply := c.request(t, "c"); reply != "T05watch:4000;" || machine.Lc4.Pc != 0x0002 {
+		t.Errorf("Expected T05watch:4000; at 0x0002, but got %s at 0x%04X", reply, machine.Lc4.Pc)
+	}
+}
+
+func TestWatchpointIgnoresFailedStore(t *testing.T) {
+	c := startServer(t)
+	// user code can't write to os data, so the STR does nothing
+	machine.Lc4.Reg[2] = 0xA000
+
+	c.request(t, "Z2,a000,2")
+	if reply := c.request(t, "c"); reply != "W00" {
+		t.Error("Expected the program to run to the end, but got", reply)
+	}
+}
+
+func TestTargetXml(t *testing.T) {
+	c := startServer(t)
+
+	if reply := c.request(t, "qSupported:multiprocess+"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Error("Expected qXfer:features:read+ to be supported, but got", reply)
+	}
+	reply := c.request(t, "qXfer:features:read:target.xml:0,fff")
+	if !strings.HasPrefix(reply, "l<?xml") || !strings.Contains(reply, `name="psr"`) {
+		t.Error("Unexpected target description:", reply)
+	}
+}
@@ -0,0 +1,183 @@
+// Package jsonrpc exposes the emulator over JSON-RPC 2.0, one JSON object per
+// line, so that tools can drive it and get structured results instead of
+// scraping the REPL.
+//
+// Addresses and values may be given as numbers or as expression strings, such
+// as "MAIN" or "R6 - 1", which are evaluated like print arguments. Every
+// method is listed in methods.
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// error codes from the JSON-RPC 2.0 specification
+const (
+	PARSE_ERROR      = -32700
+	INVALID_REQUEST  = -32600
+	METHOD_NOT_FOUND = -32601
+	INVALID_PARAMS   = -32602
+	// any error reported by the emulator
+	EMULATOR_ERROR = -32000
+)
+
+const MAX_LINE_SIZE = 1 << 20
+
+// continue runs for at most this many instructions when maxSteps isn't given,
+// so that a program that never halts can't block the requests after it
+const DEFAULT_MAX_STEPS = 1 << 20
+
+type request struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func errorf(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Serve answers requests read from reader, one per line, until it closes.
+// Notifications, which have no id, are executed without a response.
+func Serve(reader io.Reader, writer io.Writer) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, MAX_LINE_SIZE)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if resp := Handle(line); resp != nil {
+			if _, err := writer.Write(append(resp, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Handle answers one encoded request, and returns the encoded response, or nil
+// for a notification
+func Handle(data []byte) []byte {
+	resp := handleRequest(data)
+	if resp == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		encoded, _ = json.Marshal(&response{
+			Jsonrpc: "2.0",
+			Id:      resp.Id,
+			Error:   errorf(EMULATOR_ERROR, "%s", err),
+		})
+	}
+	return encoded
+}
+
+// ListenAndServe accepts connections on the Unix socket at path, serving one
+// at a time since they share the machine
+func ListenAndServe(path string) error {
+	// remove a socket left behind by an earlier server
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	fmt.Println("Listening for JSON-RPC on", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		Serve(conn, conn)
+		conn.Close()
+	}
+}
+
+func handleRequest(data []byte) *response {
+	req := request{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &response{
+			Jsonrpc: "2.0",
+			Id:      json.RawMessage("null"),
+			Error:   errorf(PARSE_ERROR, "Parse error: %s", err),
+		}
+	}
+
+	result, err := call(&req)
+	if req.Id == nil {
+		return nil
+	}
+
+	resp := &response{Jsonrpc: "2.0", Id: req.Id}
+	if err != nil {
+		rpcErr := &Error{}
+		if !errors.As(err, &rpcErr) {
+			rpcErr = errorf(EMULATOR_ERROR, "%s", err)
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func call(req *request) (interface{}, error) {
+	if req.Jsonrpc != "2.0" || req.Method == "" {
+		return nil, errorf(INVALID_REQUEST, "Invalid request")
+	}
+
+	method, exists := methods[req.Method]
+	if !exists {
+		return nil, errorf(METHOD_NOT_FOUND, "Method not found: %s", req.Method)
+	}
+
+	params := req.Params
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage("{}")
+	}
+	return method(params)
+}
+
+// decodeParams unmarshals named params, rejecting unknown ones
+func decodeParams(params json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errorf(INVALID_PARAMS, "Invalid params: %s", err)
+	}
+	return nil
+}
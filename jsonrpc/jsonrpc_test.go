@@ -0,0 +1,190 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadProgram loads a call to a subroutine that doubles R0:
+//
+//	0x0000 MAIN: CONST R0, #5
+//	0x0001       JSR DOUBLE
+//	0x0002       NOP
+//	0x0010 DOUBLE: ADD R0, R0, R0
+//	0x0011       RET
+func loadProgram() {
+	emulator.Clear()
+	machine.Lc4.Pc = 0x0000
+	copy(machine.Lc4.Mem[:], []uint16{0x9005, 0x4801, 0x0000})
+	copy(machine.Lc4.Mem[0x0010:], []uint16{0x1000, 0xC1C0})
+	machine.Lc4.Labels["MAIN"] = 0x0000
+	machine.Lc4.Labels["DOUBLE"] = 0x0010
+}
+
+// serveLines sends each request on its own line and returns the responses
+func serveLines(t *testing.T, lines ...string) []map[string]interface{} {
+	out := &bytes.Buffer{}
+	if err := Serve(strings.NewReader(strings.Join(lines, "\n")), out); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := []map[string]interface{}{}
+	decoder := json.NewDecoder(out)
+	for decoder.More() {
+		resp := map[string]interface{}{}
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func TestBreakpointAndContinue(t *testing.T) {
+	loadProgram()
+	responses := serveLines(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "setBreakpoint", "params": {"addr": "DOUBLE"}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "continue"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "readRegisters"}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "finish"}`,
+	)
+	if len(responses) != 4 {
+		t.Fatal("Expected 4 responses but got", len(responses))
+	}
+
+	bp := responses[0]["result"].(map[string]interface{})
+	if bp["num"] != 1.0 || bp["addr"] != 16.0 || bp["symbol"] != "DOUBLE" {
+		t.Error("Unexpected breakpoint", bp)
+	}
+
+	stop := responses[1]["result"].(map[string]interface{})
+	if stop["reason"] != "breakpoint" || stop["breakpoint"] != 1.0 || stop["pc"] != 16.0 {
+		t.Error("Unexpected stop", stop)
+	}
+
+	regs := responses[2]["result"].(map[string]interface{})
+	if regs["reg"].([]interface{})[0] != 5.0 {
+		t.Error("Expected R0 to be 5 but got", regs["reg"])
+	}
+
+	stop = responses[3]["result"].(map[string]interface{})
+	if stop["reason"] != "done" || stop["pc"] != 2.0 || machine.Lc4.Reg[0] != 10 {
+		t.Error("Unexpected stop after finish", stop, machine.Lc4.Reg[0])
+	}
+}
+
+func TestBreakpointOnLastStep(t *testing.T) {
+	for _, line := range []string{
+		`{"jsonrpc": "2.0", "id": 2, "method": "continue", "params": {"maxSteps": 2}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "step", "params": {"count": 2}}`,
+	} {
+		loadProgram()
+		// the JSR on the second step lands on the breakpoint
+		responses := serveLines(t,
+			`{"jsonrpc": "2.0", "id": 1, "method": "setBreakpoint", "params": {"addr": "DOUBLE"}}`,
+			line,
+		)
+		stop := responses[1]["result"].(map[string]interface{})
+		if stop["reason"] != "breakpoint" || stop["breakpoint"] != 1.0 || stop["pc"] != 16.0 {
+			t.Error("Unexpected stop", stop, "for", line)
+		}
+	}
+}
+
+func TestContinueInfiniteLoop(t *testing.T) {
+	emulator.Clear()
+	machine.Lc4.Pc = 0x0000
+	// BRnzp #-1 loops forever
+	machine.Lc4.Mem[0x0000] = 0x0FFF
+	responses := serveLines(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "continue"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "readRegisters"}`,
+	)
+
+	if len(responses) != 2 {
+		t.Fatal("Expected 2 responses but got", responses)
+	}
+	stop := responses[0]["result"].(map[string]interface{})
+	if stop["reason"] != "limit" || stop["pc"] != 0.0 {
+		t.Error("Unexpected stop", stop)
+	}
+	if responses[1]["result"] == nil {
+		t.Error("Expected the request after continue to be answered but got", responses[1])
+	}
+}
+
+func TestMemoryAndRegisters(t *testing.T) {
+	loadProgram()
+	responses := serveLines(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "writeMemory", "params": {"addr": "0x4000", "values": [1, -1, "MAIN + 3"]}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "readMemory", "params": {"addr": 16384, "count": 3}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "writeRegister", "params": {"name": "SP", "value": "x7FFF"}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "evaluate", "params": {"expr": "[0x4001] + R6"}}`,
+	)
+
+	mem := responses[1]["result"].(map[string]interface{})
+	values := mem["values"].([]interface{})
+	if values[0] != 1.0 || values[1] != 65535.0 || values[2] != 3.0 {
+		t.Error("Unexpected memory", values)
+	}
+
+	if machine.Lc4.Reg[6] != 0x7FFF {
+		t.Errorf("Expected SP 0x7FFF but got 0x%04X", machine.Lc4.Reg[6])
+	}
+
+	val := responses[3]["result"].(map[string]interface{})
+	if val["value"] != float64(0x7FFE) || val["signed"] != float64(0x7FFE) {
+		t.Error("Unexpected value", val)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	loadProgram()
+	responses := serveLines(t,
+		`not json`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "frobnicate"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "readMemory", "params": {"addr": "NOWHERE"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "finish"}`,
+		`{"jsonrpc": "2.0", "method": "step"}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "step", "params": {"count": 2}}`,
+	)
+
+	expected := []int{PARSE_ERROR, METHOD_NOT_FOUND, INVALID_PARAMS, EMULATOR_ERROR}
+	for i, code := range expected {
+		err, ok := responses[i]["error"].(map[string]interface{})
+		if !ok || err["code"] != float64(code) {
+			t.Error("Response", i, "expected error code", code, "but got", responses[i])
+		}
+	}
+
+	// the notification steps once without a response
+	if len(responses) != 5 || responses[4]["id"] != 4.0 {
+		t.Fatal("Expected the last response to have id 4 but got", responses)
+	}
+	if machine.Lc4.Pc != 0x0011 {
+		t.Errorf("Expected pc 0x0011 after 3 steps but got 0x%04X", machine.Lc4.Pc)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	emulator.Clear()
+	fileName := filepath.Join(t.TempDir(), "bad.asm")
+	if err := os.WriteFile(fileName, []byte("\tADD R1, R9, R1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	line, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1, "method": "load", "params": map[string]interface{}{"files": []string{fileName}},
+	})
+	responses := serveLines(t, string(line))
+	err, ok := responses[0]["error"].(map[string]interface{})
+	if !ok || err["code"] != float64(EMULATOR_ERROR) || err["message"] != fileName+`:1:10: expected a register but got "R9"` {
+		t.Error("Expected the assembler's error but got", responses[0])
+	}
+}
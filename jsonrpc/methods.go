@@ -0,0 +1,455 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"os"
+	"strings"
+)
+
+var methods map[string]func(json.RawMessage) (interface{}, error)
+
+func init() {
+	methods = map[string]func(json.RawMessage) (interface{}, error){
+		"load":              load,
+		"clear":             clear,
+		"reset":             reset,
+		"step":              step,
+		"next":              next,
+		"finish":            finish,
+		"continue":          resume,
+		"setBreakpoint":     setBreakpoint,
+		"deleteBreakpoint":  deleteBreakpoint,
+		"enableBreakpoint":  enableBreakpoint,
+		"disableBreakpoint": disableBreakpoint,
+		"listBreakpoints":   listBreakpoints,
+		"readRegisters":     readRegisters,
+		"writeRegister":     writeRegister,
+		"readMemory":        readMemory,
+		"writeMemory":       writeMemory,
+		"evaluate":          evaluate,
+		"disassemble":       disassemble,
+		"backtrace":         backtrace,
+		"symbols":           symbols,
+	}
+}
+
+// word is a 16-bit value given as a number or as an expression string
+type word uint16
+
+func (w *word) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		val, err := emulator.Eval(expr)
+		*w = word(val)
+		return err
+	}
+
+	var num int
+	if err := json.Unmarshal(data, &num); err != nil {
+		return errorf(INVALID_PARAMS, "expected a number or expression, got %s", data)
+	} else if num < -0x8000 || num > 0xFFFF {
+		return errorf(INVALID_PARAMS, "%d does not fit in 16 bits", num)
+	}
+	*w = word(num)
+	return nil
+}
+
+type stopResult struct {
+	// done, breakpoint, halted, error, or limit if maxSteps ran out
+	Reason     string `json:"reason"`
+	Breakpoint int    `json:"breakpoint,omitempty"`
+	Pc         uint16 `json:"pc"`
+}
+
+func stopped(stop emulator.Stop) stopResult {
+	result := stopResult{Reason: string(stop.Reason), Pc: machine.Lc4.Pc}
+	// a breakpoint hit on the last counted step is still a breakpoint stop
+	if stop.Breakpoint != nil {
+		result.Reason = string(emulator.StopBreakpoint)
+		result.Breakpoint = stop.Breakpoint.Num
+	}
+	return result
+}
+
+type breakpointResult struct {
+	Num     int    `json:"num"`
+	Addr    uint16 `json:"addr"`
+	Symbol  string `json:"symbol"`
+	Enabled bool   `json:"enabled"`
+	Temp    bool   `json:"temp"`
+	Ignore  int    `json:"ignore"`
+	Hits    int    `json:"hits"`
+	// set for watchpoints, which have no address
+	Expr string `json:"expr,omitempty"`
+}
+
+func describeBreakpoint(bp *emulator.Breakpoint) breakpointResult {
+	return breakpointResult{
+		Num:     bp.Num,
+		Addr:    bp.Addr,
+		Symbol:  emulator.Symbolize(bp.Addr),
+		Enabled: bp.Enabled,
+		Temp:    bp.Temp,
+		Ignore:  bp.Ignore,
+		Hits:    bp.Hits,
+		Expr:    bp.Expr,
+	}
+}
+
+type empty struct{}
+
+func load(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Files []string `json:"files"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if len(args.Files) == 0 {
+		return nil, errorf(INVALID_PARAMS, "No files to load")
+	}
+
+	for _, fileName := range args.Files {
+		if _, err := os.Stat(fileName); err != nil {
+			return nil, errorf(EMULATOR_ERROR, "File not found: %s", fileName)
+		}
+	}
+	for _, fileName := range args.Files {
+		if err := emulator.Load(fileName); err != nil {
+			return nil, errorf(EMULATOR_ERROR, "%s", err)
+		}
+	}
+	return symbols(nil)
+}
+
+func clear(params json.RawMessage) (interface{}, error) {
+	emulator.Clear()
+	return empty{}, nil
+}
+
+func reset(params json.RawMessage) (interface{}, error) {
+	emulator.Reset()
+	return readRegisters(nil)
+}
+
+// step executes count instructions, stopping early at breakpoints
+func step(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Count int `json:"count"`
+	}{Count: 1}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Count < 1 {
+		return nil, errorf(INVALID_PARAMS, "Invalid count: %d", args.Count)
+	}
+
+	left := args.Count
+	return stopped(emulator.RunUntil(func() bool {
+		left--
+		return left <= 0
+	})), nil
+}
+
+// next steps over count instructions, running calls to their return
+func next(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Count int `json:"count"`
+	}{Count: 1}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Count < 1 {
+		return nil, errorf(INVALID_PARAMS, "Invalid count: %d", args.Count)
+	}
+
+	stop := emulator.Stop{Reason: emulator.StopDone}
+	for i := 0; i < args.Count && stop.Reason == emulator.StopDone && stop.Breakpoint == nil; i++ {
+		stop = emulator.StepOver()
+	}
+	return stopped(stop), nil
+}
+
+func finish(params json.RawMessage) (interface{}, error) {
+	stop, err := emulator.StepOut()
+	if err != nil {
+		return nil, err
+	}
+	return stopped(stop), nil
+}
+
+// resume continues until a breakpoint or the program halts, or for at most
+// maxSteps instructions, which defaults to DEFAULT_MAX_STEPS
+func resume(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		MaxSteps int `json:"maxSteps"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.MaxSteps <= 0 {
+		args.MaxSteps = DEFAULT_MAX_STEPS
+	}
+
+	steps := 0
+	stop := emulator.RunUntil(func() bool {
+		steps++
+		return steps >= args.MaxSteps
+	})
+
+	result := stopped(stop)
+	if stop.Reason == emulator.StopDone && stop.Breakpoint == nil {
+		result.Reason = "limit"
+	}
+	return result, nil
+}
+
+func setBreakpoint(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Addr *word `json:"addr"`
+		Temp bool  `json:"temp"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Addr == nil {
+		return nil, errorf(INVALID_PARAMS, "Missing addr")
+	}
+
+	return describeBreakpoint(emulator.AddBreakpoint(uint16(*args.Addr), args.Temp)), nil
+}
+
+func lookupBreakpoint(params json.RawMessage) (*emulator.Breakpoint, error) {
+	args := struct {
+		Num int `json:"num"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	bp := emulator.LookupBreakpoint(args.Num)
+	if bp == nil {
+		return nil, errorf(EMULATOR_ERROR, "No breakpoint number %d", args.Num)
+	}
+	return bp, nil
+}
+
+func deleteBreakpoint(params json.RawMessage) (interface{}, error) {
+	bp, err := lookupBreakpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	emulator.RemoveBreakpoint(bp)
+	return empty{}, nil
+}
+
+func enableBreakpoint(params json.RawMessage) (interface{}, error) {
+	bp, err := lookupBreakpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bp.Enabled = true
+	return describeBreakpoint(bp), nil
+}
+
+func disableBreakpoint(params json.RawMessage) (interface{}, error) {
+	bp, err := lookupBreakpoint(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bp.Enabled = false
+	return describeBreakpoint(bp), nil
+}
+
+func listBreakpoints(params json.RawMessage) (interface{}, error) {
+	results := []breakpointResult{}
+	for _, bp := range emulator.Breakpoints() {
+		results = append(results, describeBreakpoint(bp))
+	}
+	return results, nil
+}
+
+func readRegisters(params json.RawMessage) (interface{}, error) {
+	psr := machine.Lc4.Psr
+	return struct {
+		Reg       [machine.NUM_REGS]uint16 `json:"reg"`
+		Pc        uint16                   `json:"pc"`
+		Psr       uint16                   `json:"psr"`
+		N         bool                     `json:"n"`
+		Z         bool                     `json:"z"`
+		P         bool                     `json:"p"`
+		Privilege bool                     `json:"privilege"`
+	}{
+		Reg:       machine.Lc4.Reg,
+		Pc:        machine.Lc4.Pc,
+		Psr:       psr,
+		N:         psr&0b100 != 0,
+		Z:         psr&0b010 != 0,
+		P:         psr&0b001 != 0,
+		Privilege: psr&0x8000 != 0,
+	}, nil
+}
+
+// writeRegister sets R0-R7 (or SP, FP, RA), PC or PSR
+func writeRegister(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Name  string `json:"name"`
+		Value *word  `json:"value"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Value == nil {
+		return nil, errorf(INVALID_PARAMS, "Missing value")
+	}
+
+	val := uint16(*args.Value)
+	switch strings.ToUpper(args.Name) {
+	case "PC":
+		machine.Lc4.Pc = val
+	case "PSR":
+		machine.Lc4.Psr = val
+	default:
+		reg, err := emulator.ParseReg(args.Name)
+		if err != nil {
+			return nil, errorf(INVALID_PARAMS, "Invalid register: %s", args.Name)
+		}
+		machine.Lc4.Reg[reg] = val
+	}
+	return readRegisters(nil)
+}
+
+type memoryResult struct {
+	Addr   uint16   `json:"addr"`
+	Values []uint16 `json:"values"`
+}
+
+func readMemory(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Addr  *word `json:"addr"`
+		Count int   `json:"count"`
+	}{Count: 1}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Addr == nil {
+		return nil, errorf(INVALID_PARAMS, "Missing addr")
+	} else if args.Count < 0 || args.Count > machine.MEM_SIZE {
+		return nil, errorf(INVALID_PARAMS, "Invalid count: %d", args.Count)
+	}
+
+	addr := uint16(*args.Addr)
+	values := make([]uint16, args.Count)
+	for i := range values {
+		values[i] = machine.Lc4.Mem[addr+uint16(i)]
+	}
+	return memoryResult{Addr: addr, Values: values}, nil
+}
+
+func writeMemory(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Addr   *word  `json:"addr"`
+		Values []word `json:"values"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Addr == nil {
+		return nil, errorf(INVALID_PARAMS, "Missing addr")
+	}
+
+	addr := uint16(*args.Addr)
+	values := make([]uint16, len(args.Values))
+	for i, val := range args.Values {
+		machine.Lc4.Mem[addr+uint16(i)] = uint16(val)
+		values[i] = uint16(val)
+	}
+	return memoryResult{Addr: addr, Values: values}, nil
+}
+
+func evaluate(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Expr string `json:"expr"`
+	}{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+
+	val, err := emulator.Eval(args.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Value  uint16 `json:"value"`
+		Signed int16  `json:"signed"`
+	}{val, int16(val)}, nil
+}
+
+type insnResult struct {
+	Addr   uint16  `json:"addr"`
+	Word   uint16  `json:"word"`
+	Asm    string  `json:"asm"`
+	Label  string  `json:"label,omitempty"`
+	Target *uint16 `json:"target,omitempty"`
+	Line   int     `json:"line,omitempty"`
+	File   string  `json:"file,omitempty"`
+}
+
+// disassemble decodes count instructions, starting at addr or the pc
+func disassemble(params json.RawMessage) (interface{}, error) {
+	args := struct {
+		Addr  *word `json:"addr"`
+		Count int   `json:"count"`
+	}{Count: 1}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	} else if args.Count < 0 || args.Count > machine.MEM_SIZE {
+		return nil, errorf(INVALID_PARAMS, "Invalid count: %d", args.Count)
+	}
+
+	addr := machine.Lc4.Pc
+	if args.Addr != nil {
+		addr = uint16(*args.Addr)
+	}
+
+	results := []insnResult{}
+	for i := 0; i < args.Count; i++ {
+		insn := machine.Decode(addr)
+		meta := machine.Lc4.Meta[addr]
+		result := insnResult{
+			Addr:  addr,
+			Word:  machine.Lc4.Mem[addr],
+			Asm:   insn.Asm(),
+			Label: meta.Label,
+		}
+		if target, ok := insn.Target(addr); ok {
+			result.Target = &target
+		}
+		if meta.Line != 0 && meta.File < len(machine.Lc4.Files) {
+			result.Line = int(meta.Line)
+			result.File = machine.Lc4.Files[meta.File]
+		}
+		results = append(results, result)
+		addr++
+	}
+	return results, nil
+}
+
+func backtrace(params json.RawMessage) (interface{}, error) {
+	type frame struct {
+		Pc       uint16 `json:"pc"`
+		Function string `json:"function"`
+	}
+
+	frames := []frame{}
+	for _, pc := range emulator.FramePcs() {
+		frames = append(frames, frame{Pc: pc, Function: emulator.Symbolize(pc)})
+	}
+	return frames, nil
+}
+
+func symbols(params json.RawMessage) (interface{}, error) {
+	labels := map[string]uint16{}
+	for label, addr := range machine.Lc4.Labels {
+		labels[label] = addr
+	}
+	return labels, nil
+}
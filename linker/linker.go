@@ -0,0 +1,224 @@
+// Package linker merges object files into one, filling in the references
+// each makes to labels defined in the others (see .EXTERN in the assembler).
+//
+// LC4 blocks are placed at fixed addresses, so the linker never moves them.
+// Instead it reports blocks that overlap, and labels defined at different
+// addresses by more than one object file.
+package linker
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/assembler"
+	"github.com/hryoma/lc4go/tokenizer"
+	"sort"
+	"strings"
+)
+
+// Object is an object file to link, along with the name errors call it by
+type Object struct {
+	Name string
+	Prog *assembler.Program
+}
+
+// ErrorList holds every problem found while linking
+type ErrorList []error
+
+func (errs ErrorList) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// block is a segment of an object file, copied so it can be filled in
+type block struct {
+	obj string
+	seg *tokenizer.Segment
+}
+
+func (b block) String() string {
+	kind := "code"
+	if b.seg.Data {
+		kind = "data"
+	}
+	return fmt.Sprintf("%s %s block x%04X-x%04X", b.obj, kind, b.seg.Addr, b.end()-1)
+}
+
+func (b block) end() int {
+	return int(b.seg.Addr) + len(b.seg.Words)
+}
+
+// LinkFiles reads and links object files
+func LinkFiles(fileNames []string) (*assembler.Program, error) {
+	objs := make([]Object, len(fileNames))
+	for i, fileName := range fileNames {
+		prog, err := assembler.ReadObjFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		objs[i] = Object{Name: fileName, Prog: prog}
+	}
+	return Link(objs)
+}
+
+// Link merges objects into one program, with the symbols, source files and
+// line numbers of each. The error is an ErrorList if any objects overlap,
+// define the same symbol, or refer to a symbol none of them define.
+func Link(objs []Object) (*assembler.Program, error) {
+	out := &assembler.Program{
+		Program: tokenizer.Program{Symbols: map[string]uint16{}},
+		Consts:  map[string]int{},
+	}
+	var errs ErrorList
+
+	// which object defined each symbol
+	owners := map[string]string{}
+	// the blocks of each object, in order
+	blocks := make([][]block, len(objs))
+	var all []block
+	for n, obj := range objs {
+		fileBase := uint16(len(out.Files))
+		out.Files = append(out.Files, obj.Prog.Files...)
+
+		for _, seg := range obj.Prog.Segments {
+			if len(seg.Words) == 0 {
+				continue
+			}
+			b := block{obj: obj.Name, seg: &tokenizer.Segment{
+				Data:   seg.Data,
+				Addr:   seg.Addr,
+				Words:  append([]uint16(nil), seg.Words...),
+				Offset: -1,
+			}}
+			blocks[n] = append(blocks[n], b)
+			all = append(all, b)
+		}
+
+		for _, line := range obj.Prog.Lines {
+			line.FileIdx += fileBase
+			line.Offset = -1
+			out.Lines = append(out.Lines, line)
+		}
+
+		for _, name := range obj.Prog.SymbolNames() {
+			if obj.Prog.Locals[name] {
+				continue
+			}
+			addr := obj.Prog.Symbols[name]
+			if prev, exists := out.Symbols[name]; !exists {
+				out.Symbols[name] = addr
+				owners[name] = obj.Name
+			} else if prev != addr {
+				errs = append(errs, fmt.Errorf("%s is defined in both %s (x%04X) and %s (x%04X)",
+					name, owners[name], prev, obj.Name, addr))
+			}
+		}
+	}
+
+	errs = append(errs, checkOverlaps(all)...)
+
+	for n, obj := range objs {
+		for _, reloc := range obj.Prog.Relocs {
+			if err := resolve(reloc, blocks[n], out.Symbols); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", obj.Name, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	out.Segments = merge(all)
+	return out, nil
+}
+
+// checkOverlaps reports every pair of blocks that share an address
+func checkOverlaps(all []block) (errs ErrorList) {
+	sorted := append([]block(nil), all...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].seg.Addr < sorted[j].seg.Addr
+	})
+
+	for i, b := range sorted {
+		for _, next := range sorted[i+1:] {
+			if int(next.seg.Addr) >= b.end() {
+				break
+			}
+			errs = append(errs, fmt.Errorf("%s overlaps %s", b, next))
+		}
+	}
+	return errs
+}
+
+// resolve fills in the word a relocation refers to
+func resolve(reloc tokenizer.Reloc, blocks []block, symbols map[string]uint16) error {
+	var word *uint16
+	for _, b := range blocks {
+		if reloc.Addr >= b.seg.Addr && int(reloc.Addr) < b.end() {
+			word = &b.seg.Words[reloc.Addr-b.seg.Addr]
+		}
+	}
+	if word == nil {
+		return fmt.Errorf("reference to %s at x%04X is outside every block", reloc.Symbol, reloc.Addr)
+	}
+
+	addr, exists := symbols[reloc.Symbol]
+	if !exists {
+		return fmt.Errorf("undefined symbol %s referenced at x%04X", reloc.Symbol, reloc.Addr)
+	}
+	target := int(addr) + int(reloc.Offset)
+	name := reloc.Symbol
+	if reloc.Offset != 0 {
+		name = fmt.Sprintf("%s%+d", reloc.Symbol, reloc.Offset)
+	}
+
+	switch reloc.Kind {
+	case tokenizer.RELOC_WORD:
+		*word = uint16(target)
+	case tokenizer.RELOC_PC9, tokenizer.RELOC_PC11:
+		offset := target - int(reloc.Addr) - 1
+		bits := map[uint16]uint{tokenizer.RELOC_PC9: 9, tokenizer.RELOC_PC11: 11}[reloc.Kind]
+		if offset < -(1<<(bits-1)) || offset >= 1<<(bits-1) {
+			return fmt.Errorf("%s at x%04X is out of reach of x%04X", name, uint16(target), reloc.Addr)
+		}
+		mask := uint16(1)<<bits - 1
+		*word = *word&^mask | uint16(offset)&mask
+	case tokenizer.RELOC_JSR:
+		if target%assembler.FALIGN_SIZE != 0 {
+			return fmt.Errorf("JSR target %s at x%04X is not aligned, use .FALIGN", name, uint16(target))
+		} else if uint16(target)&0x8000 != reloc.Addr&0x8000 {
+			return fmt.Errorf("JSR target %s at x%04X is out of reach of x%04X", name, uint16(target), reloc.Addr)
+		}
+		*word = *word&^0x7FF | uint16(target>>4)&0x7FF
+	case tokenizer.RELOC_LO8:
+		*word = *word&^0x1FF | uint16(target)&0xFF
+	case tokenizer.RELOC_HI8:
+		*word = *word&^0xFF | uint16(target)>>8
+	default:
+		return fmt.Errorf("unknown relocation kind %d at x%04X", reloc.Kind, reloc.Addr)
+	}
+	return nil
+}
+
+// merge sorts blocks by address, joining blocks of the same kind that follow
+// on from each other
+func merge(all []block) []*tokenizer.Segment {
+	sorted := append([]block(nil), all...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].seg.Addr < sorted[j].seg.Addr
+	})
+
+	var segs []*tokenizer.Segment
+	for _, b := range sorted {
+		if n := len(segs); n > 0 {
+			last := segs[n-1]
+			if last.Data == b.seg.Data && int(last.Addr)+len(last.Words) == int(b.seg.Addr) {
+				last.Words = append(last.Words, b.seg.Words...)
+				continue
+			}
+		}
+		segs = append(segs, b.seg)
+	}
+	return segs
+}
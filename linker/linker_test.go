@@ -0,0 +1,138 @@
+package linker
+
+import (
+	"bytes"
+	"github.com/hryoma/lc4go/assembler"
+	"strings"
+	"testing"
+)
+
+func assemble(t *testing.T, fileName string, src string) Object {
+	prog, err := assembler.Assemble(fileName, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Object{Name: fileName, Prog: prog}
+}
+
+func TestLink(t *testing.T) {
+	main := assemble(t, "main.asm", `
+	.EXTERN DOUBLE, COUNT
+MAIN	LEA R1, COUNT
+	JSR DOUBLE
+	BRnzp DOUBLE+1
+	.FILL COUNT+1`)
+	lib := assemble(t, "lib.asm", `
+	.ADDR x0010
+DOUBLE	ADD R0, R0, R0
+	RET
+	.DATA
+	.ADDR x4100
+COUNT	.FILL #7`)
+
+	prog, err := Link([]Object{main, lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prog.Segments) != 3 {
+		t.Fatal("Expected 3 segments but got", len(prog.Segments))
+	}
+	expected := []uint16{0x9200, 0xD341, 0x4801, 0x0E0D, 0x4101}
+	words := prog.Segments[0].Words
+	for i := range expected {
+		if words[i] != expected[i] {
+			t.Errorf("Expected x%04X at %d but got x%04X", expected[i], i, words[i])
+		}
+	}
+
+	if prog.Symbols["MAIN"] != 0x0000 || prog.Symbols["DOUBLE"] != 0x0010 || prog.Symbols["COUNT"] != 0x4100 {
+		t.Error("Unexpected symbols", prog.Symbols)
+	}
+	if len(prog.Relocs) != 0 {
+		t.Error("Expected no relocations but got", prog.Relocs)
+	}
+
+	// line numbers refer to the file each word came from
+	if len(prog.Files) != 2 || prog.Files[0] != "main.asm" || prog.Files[1] != "lib.asm" {
+		t.Fatal("Unexpected files", prog.Files)
+	}
+	if line, _ := prog.LineAt(prog.Segments[1].Addr); line.Line != 3 || prog.Files[line.FileIdx] != "lib.asm" {
+		t.Error("Unexpected line info", prog.Lines)
+	}
+}
+
+func TestLinkMergesBlocks(t *testing.T) {
+	a := assemble(t, "a.asm", "A\tNOP\n\tNOP")
+	b := assemble(t, "b.asm", "\t.ADDR x0002\nB\tNOP")
+
+	prog, err := Link([]Object{b, a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.Segments) != 1 || prog.Segments[0].Addr != 0 || len(prog.Segments[0].Words) != 3 {
+		t.Error("Expected one block of 3 words at x0000 but got", prog.Segments)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	a := assemble(t, "a.asm", `
+	.EXTERN MISSING, FAR
+START	NOP
+	JSR FAR
+	BRz MISSING`)
+	b := assemble(t, "b.asm", `
+	.ADDR x0001
+START	NOP
+FAR	NOP`)
+
+	_, err := Link([]Object{a, b})
+	expected := []string{
+		"START is defined in both a.asm (x0000) and b.asm (x0001)",
+		"a.asm code block x0000-x0002 overlaps b.asm code block x0001-x0002",
+		"a.asm: JSR target FAR at x0002 is not aligned, use .FALIGN",
+		"a.asm: undefined symbol MISSING referenced at x0002",
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatal("Expected an ErrorList but got", err)
+	}
+	if len(errs) != len(expected) {
+		t.Error("Expected", len(expected), "errors but got", errs)
+	}
+	for i := 0; i < len(errs) && i < len(expected); i++ {
+		if errs[i].Error() != expected[i] {
+			t.Error("Expected", expected[i], "but got", errs[i])
+		}
+	}
+}
+
+func TestLinkLocalLabels(t *testing.T) {
+	const spin = "\t.MACRO SPIN\n@WAIT\tBRnzp @WAIT\n\t.ENDM\n"
+	a := assemble(t, "a.asm", spin+"\tSPIN\nstr.len\t.FILL #3")
+	b := assemble(t, "b.asm", spin+"\t.ADDR x0010\n\tSPIN\nstr.len\t.FILL #4\nc.d\tNOP")
+	c := assemble(t, "c.asm", "\t.ADDR x0020\nstr.len\t.FILL #5\nc.d\tNOP")
+
+	// each file's WAIT.1 is its own, but labels with dots are like any other
+	_, err := Link([]Object{a, b, c})
+	expected := []string{
+		"str.len is defined in both a.asm (x0001) and b.asm (x0011)",
+		"str.len is defined in both a.asm (x0001) and c.asm (x0020)",
+		"c.d is defined in both b.asm (x0012) and c.asm (x0021)",
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Error("Expected", expected, "but got", err)
+	}
+
+	var buf bytes.Buffer
+	if err := a.Prog.WriteObj(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := assembler.ReadObj(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := read.Symbols["WAIT.1"]; ok || read.Symbols["str.len"] != 1 {
+		t.Error("Expected only str.len in the object file but got", read.Symbols)
+	}
+}
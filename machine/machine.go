@@ -121,25 +121,174 @@ func (insn Insn) String() string {
 	return fmt.Sprintf("%016b\n%s: R%d, R%d, R%d, %d", insn.Data, insn.OpName, insn.Rd, insn.Rs, insn.Rt, insn.Imm)
 }
 
+// Asm formats the instruction in LC4 assembly syntax
+func (insn Insn) Asm() string {
+	switch insn.OpName {
+	case OpNOP:
+		// unused opcodes also decode to NOP
+		if insn.Data>>12 == 0 {
+			return "NOP"
+		}
+	case OpRTI:
+		return "RTI"
+	case OpBRp, OpBRz, OpBRzp, OpBRn, OpBRnp, OpBRnz, OpBRnzp, OpJSR, OpJMP:
+		return fmt.Sprintf("%s #%d", insn.OpName, insn.Imm)
+	case OpADD, OpMUL, OpSUB, OpDIV, OpAND, OpOR, OpXOR, OpMOD:
+		return fmt.Sprintf("%s R%d, R%d, R%d", insn.OpName, insn.Rd, insn.Rs, insn.Rt)
+	case OpADDI:
+		return fmt.Sprintf("ADD R%d, R%d, #%d", insn.Rd, insn.Rs, insn.Imm)
+	case OpANDI:
+		return fmt.Sprintf("AND R%d, R%d, #%d", insn.Rd, insn.Rs, insn.Imm)
+	case OpNOT:
+		return fmt.Sprintf("NOT R%d, R%d", insn.Rd, insn.Rs)
+	case OpCMP, OpCMPU:
+		return fmt.Sprintf("%s R%d, R%d", insn.OpName, insn.Rs, insn.Rt)
+	case OpCMPI, OpCMPIU:
+		return fmt.Sprintf("%s R%d, #%d", insn.OpName, insn.Rs, insn.Imm)
+	case OpJSRR, OpJMPR:
+		return fmt.Sprintf("%s R%d", insn.OpName, insn.Rs)
+	case OpLDR:
+		return fmt.Sprintf("LDR R%d, R%d, #%d", insn.Rd, insn.Rs, insn.Imm)
+	case OpSTR:
+		return fmt.Sprintf("STR R%d, R%d, #%d", insn.Rt, insn.Rs, insn.Imm)
+	case OpCONST, OpHICONST:
+		return fmt.Sprintf("%s R%d, #%d", insn.OpName, insn.Rd, insn.Imm)
+	case OpSLL, OpSRA, OpSRL:
+		return fmt.Sprintf("%s R%d, R%d, #%d", insn.OpName, insn.Rd, insn.Rs, insn.Imm)
+	case OpTRAP:
+		return fmt.Sprintf("TRAP x%02X", insn.Imm)
+	}
+	return fmt.Sprintf(".FILL x%04X", insn.Data)
+}
+
+// Target returns the address a control flow instruction at addr jumps to
+func (insn Insn) Target(addr uint16) (target uint16, ok bool) {
+	switch insn.OpName {
+	case OpBRp, OpBRz, OpBRzp, OpBRn, OpBRnp, OpBRnz, OpBRnzp, OpJMP:
+		return uint16(int32(addr) + 1 + int32(insn.Imm)), true
+	case OpJSR:
+		return (addr & 0x8000) | (uint16(insn.Imm) << 4), true
+	case OpTRAP:
+		return 0x8000 | uint16(insn.Imm), true
+	}
+	return 0, false
+}
+
+// DataAddr returns the data memory address that LDR or STR accesses with the
+// current register values
+func (insn Insn) DataAddr() (addr uint16, ok bool) {
+	switch insn.OpName {
+	case OpLDR, OpSTR:
+		return uint16(int16(Lc4.Reg[insn.Rs]) + insn.Imm), true
+	}
+	return 0, false
+}
+
 type MemMetadata struct {
-	Label      string
-	Breakpoint bool
+	Label string
+	// source line of the word, or 0 if unknown, and its index in Files
+	Line uint16
+	File int
+}
+
+// Block is a range of memory loaded from a file, which later loads are
+// checked against
+type Block struct {
+	Addr uint16
+	Len  int
+	Data bool
+	File string
 }
 
 type Machine struct {
 	Mem    [MEM_SIZE]uint16
 	Reg    [NUM_REGS]uint16
-	Nzp    int8
 	Psr    uint16
 	Pc     uint16
 	Labels map[string]uint16
 	Meta   map[uint16]MemMetadata
+	Files  []string
+	Blocks []Block
+	// the file each label, and each of Files, was loaded from
+	LabelSources map[string]string
+	FileSources  []string
 }
 
 var Lc4 Machine
 
-func wordToInsn(addr uint16) (insn Insn) {
-	word := Lc4.Mem[addr]
+// SetBlocks records the blocks loaded from a file, replacing any loaded from
+// it before
+func SetBlocks(file string, blocks []Block) {
+	kept := Lc4.Blocks[:0]
+	for _, block := range Lc4.Blocks {
+		if block.File != file {
+			kept = append(kept, block)
+		}
+	}
+	Lc4.Blocks = append(kept, blocks...)
+}
+
+// ForgetFile drops the labels and source file names loaded from a file, and
+// the line numbers that refer to them, so that loading it again replaces them
+// the way SetBlocks replaces its blocks
+func ForgetFile(file string) {
+	for label, source := range Lc4.LabelSources {
+		if source != file {
+			continue
+		}
+		addr := Lc4.Labels[label]
+		if meta, exists := Lc4.Meta[addr]; exists && meta.Label == label {
+			meta.Label = ""
+			setMeta(addr, meta)
+		}
+		delete(Lc4.Labels, label)
+		delete(Lc4.LabelSources, label)
+	}
+
+	// the files that are kept are renumbered
+	fileIdxs := make([]int, len(Lc4.Files))
+	var files, sources []string
+	for i, name := range Lc4.Files {
+		source := ""
+		if i < len(Lc4.FileSources) {
+			source = Lc4.FileSources[i]
+		}
+		if source == file {
+			fileIdxs[i] = -1
+			continue
+		}
+		fileIdxs[i] = len(files)
+		files = append(files, name)
+		sources = append(sources, source)
+	}
+	if len(files) == len(Lc4.Files) {
+		return
+	}
+
+	for addr, meta := range Lc4.Meta {
+		if meta.Line == 0 || meta.File < 0 || meta.File >= len(fileIdxs) {
+			continue
+		}
+		if fileIdxs[meta.File] < 0 {
+			meta.Line, meta.File = 0, 0
+		} else {
+			meta.File = fileIdxs[meta.File]
+		}
+		setMeta(addr, meta)
+	}
+	Lc4.Files, Lc4.FileSources = files, sources
+}
+
+// setMeta sets the metadata of an address, dropping it once there is none
+func setMeta(addr uint16, meta MemMetadata) {
+	if meta == (MemMetadata{}) {
+		delete(Lc4.Meta, addr)
+	} else {
+		Lc4.Meta[addr] = meta
+	}
+}
+
+func wordToInsn(word uint16) (insn Insn) {
 	opCode := word >> 12
 
 	var op Op
@@ -175,9 +324,12 @@ parse_opcode:
 			op = OpBRnzp
 		}
 
-		imm = signExtN(Lc4.Mem[addr]&0x01FF, 9)
+		imm = signExtN(word&0x01FF, 9)
 	case 0b0001:
 		// arithmetic instructions
+		rd = uint8(word>>9) & 0b0111
+		rs = uint8(word>>6) & 0b0111
+
 		subOpCode := (word >> 3) & 0b111
 		switch subOpCode {
 		case 0b000:
@@ -190,17 +342,15 @@ parse_opcode:
 			op = OpDIV
 		default:
 			op = OpADDI
-			imm = signExtN(Lc4.Mem[addr]&0x001F, 5)
+			imm = signExtN(word&0x001F, 5)
 			break parse_opcode
 		}
 
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
-		rt = uint8(Lc4.Mem[addr]) & 0b0111
+		rt = uint8(word) & 0b0111
 	case 0b1010:
 		// MOD or shift instructions
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
+		rd = uint8(word>>9) & 0b0111
+		rs = uint8(word>>6) & 0b0111
 
 		subOpCode := (word >> 4) & 0b11
 		switch subOpCode {
@@ -212,15 +362,15 @@ parse_opcode:
 			op = OpSRL
 		case 0b11:
 			op = OpMOD
-			rt = uint8(Lc4.Mem[addr]) & 0b0111
+			rt = uint8(word) & 0b0111
 			break parse_opcode
 		}
 
-		imm = int16(Lc4.Mem[addr]) & 0x000F
+		imm = int16(word) & 0x000F
 	case 0b0101:
 		// boolean instructions
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
+		rd = uint8(word>>9) & 0b0111
+		rs = uint8(word>>6) & 0b0111
 
 		subOpCode := (word >> 3) & 0b111
 		switch subOpCode {
@@ -235,51 +385,51 @@ parse_opcode:
 			op = OpXOR
 		default:
 			op = OpANDI
-			imm = signExtN(Lc4.Mem[addr]&0x001F, 5)
+			imm = signExtN(word&0x001F, 5)
 			break parse_opcode
 		}
 
-		rt = uint8(Lc4.Mem[addr]) & 0b0111
+		rt = uint8(word) & 0b0111
 	case 0b0110:
 		// LDR
 		op = OpLDR
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
-		imm = signExtN(Lc4.Mem[addr]&0x003F, 6)
+		rd = uint8(word>>9) & 0b0111
+		rs = uint8(word>>6) & 0b0111
+		imm = signExtN(word&0x003F, 6)
 	case 0b0111:
 		// STR
 		op = OpSTR
-		rt = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
-		imm = signExtN(Lc4.Mem[addr]&0x003F, 6)
+		rt = uint8(word>>9) & 0b0111
+		rs = uint8(word>>6) & 0b0111
+		imm = signExtN(word&0x003F, 6)
 	case 0b1001:
 		// CONST
 		op = OpCONST
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		imm = signExtN(Lc4.Mem[addr]&0x003F, 6)
+		rd = uint8(word>>9) & 0b0111
+		imm = signExtN(word&0x01FF, 9)
 	case 0b1101:
 		// HICONST
 		op = OpHICONST
-		rd = uint8(Lc4.Mem[addr]>>9) & 0b0111
-		imm = int16(Lc4.Mem[addr]) & 0x003F
+		rd = uint8(word>>9) & 0b0111
+		imm = int16(word) & 0x00FF
 	case 0b0010:
 		// comparison instructions
-		rs = uint8(Lc4.Mem[addr]>>9) & 0b0111
+		rs = uint8(word>>9) & 0b0111
 
 		subOpCode := (word >> 7) & 0b0011
 		switch subOpCode {
 		case 0b00:
 			op = OpCMP
-			rt = uint8(Lc4.Mem[addr]) & 0b0111
+			rt = uint8(word) & 0b0111
 		case 0b01:
 			op = OpCMPU
-			rt = uint8(Lc4.Mem[addr]) & 0b0111
+			rt = uint8(word) & 0b0111
 		case 0b10:
 			op = OpCMPI
-			imm = signExtN(Lc4.Mem[addr]&0x00FF, 8)
+			imm = signExtN(word&0x007F, 7)
 		case 0b11:
 			op = OpCMPIU
-			imm = int16(Lc4.Mem[addr]) & 0x00FF
+			imm = int16(word) & 0x007F
 		}
 	case 0b0100:
 		// JSRR, JSR
@@ -287,34 +437,34 @@ parse_opcode:
 		switch subOpCode {
 		case 0b0:
 			op = OpJSRR
-			rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
+			rs = uint8(word>>6) & 0b0111
 		case 0b1:
 			op = OpJSR
-			imm = signExtN(Lc4.Mem[addr]&0x07FF, 11)
+			imm = signExtN(word&0x07FF, 11)
 		}
 	case 0b1100:
 		// JMPR, JMP
 		subOpCode := (word >> 11) & 0b0001
 		switch subOpCode {
 		case 0b0:
-			op = OpJSRR
-			rs = uint8(Lc4.Mem[addr]>>6) & 0b0111
+			op = OpJMPR
+			rs = uint8(word>>6) & 0b0111
 		case 0b1:
-			op = OpJSR
-			imm = signExtN(Lc4.Mem[addr]&0x07FF, 11)
+			op = OpJMP
+			imm = signExtN(word&0x07FF, 11)
 		}
 	case 0b1111:
 		// TRAP
 		op = OpTRAP
-		imm = int16(Lc4.Mem[addr]) & 0x00FF
+		imm = int16(word) & 0x00FF
 	case 0b1000:
 		// RTI
 		op = OpRTI
-		imm = signExtN(Lc4.Mem[addr]&0x00FF, 8)
+		imm = signExtN(word&0x00FF, 8)
 	}
 
 	return Insn{
-		Data:   Lc4.Mem[addr],
+		Data:   word,
 		OpName: op,
 		Rd:     rd,
 		Rs:     rs,
@@ -324,10 +474,20 @@ parse_opcode:
 	}
 }
 
+// Decode returns the instruction stored at addr without executing it
+func Decode(addr uint16) Insn {
+	return wordToInsn(Lc4.Mem[addr])
+}
+
+// DecodeWord returns the instruction a word encodes
+func DecodeWord(word uint16) Insn {
+	return wordToInsn(word)
+}
+
 func signExtN(data uint16, nBits uint16) int16 {
 	// get the sign and generate a mask
 	var sign uint16 = data & (1 << (nBits - 1))
-	var mask uint16 = (0xFF << nBits)
+	var mask uint16 = (0xFFFF << nBits)
 
 	// sign extend it
 	if sign == 0 {
@@ -337,6 +497,17 @@ func signExtN(data uint16, nBits uint16) int16 {
 	}
 }
 
+// Nzp returns the sign the PSR's condition codes hold: -1 for n, 0 for z and
+// 1 for p
+func Nzp() int8 {
+	if Lc4.Psr&0b100 != 0 {
+		return -1
+	} else if Lc4.Psr&0b001 != 0 {
+		return 1
+	}
+	return 0
+}
+
 func setNzp(testVal int16) {
 	// reset nzp bits to 0's
 	Lc4.Psr &= 0xFFF8
@@ -350,6 +521,15 @@ func setNzp(testVal int16) {
 	}
 }
 
+// Writable reports whether STR can write to addr: only data sections are
+// writable, and os data only with enough privilege
+func Writable(addr uint16) bool {
+	if (USER_DATA_START <= addr) && (addr <= USER_DATA_END) {
+		return true
+	}
+	return (OS_DATA_START <= addr) && (addr <= OS_DATA_END) && (Lc4.Psr&0x8000) != 0
+}
+
 func uintPlusInt(val uint16, offset int16) (res uint16, err int) {
 	var tempRes int32 = int32(val) + int32(offset)
 	if 0 <= tempRes && tempRes <= 0xFFFF {
@@ -372,7 +552,7 @@ func Execute() (err int) {
 		}
 	}
 
-	insn := wordToInsn(Lc4.Pc)
+	insn := wordToInsn(Lc4.Mem[Lc4.Pc])
 	switch insn.OpName {
 	// branch instructions
 	case OpNOP:
@@ -381,37 +561,37 @@ func Execute() (err int) {
 	case OpBRp:
 		// if P, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp > 0 {
+		if Nzp() > 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRz:
 		// if Z, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp == 0 {
+		if Nzp() == 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRzp:
 		// if Z/P, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp >= 0 {
+		if Nzp() >= 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRn:
 		// if N, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp < 0 {
+		if Nzp() < 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRnp:
 		// if NP, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp != 0 {
+		if Nzp() != 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRnz:
 		// if NZ, PC = PC + 1 + sext(IMM9)
 		Lc4.Pc += 1
-		if Lc4.Nzp <= 0 {
+		if Nzp() <= 0 {
 			Lc4.Pc, err = uintPlusInt(Lc4.Pc, insn.Imm)
 		}
 	case OpBRnzp:
@@ -494,21 +674,15 @@ func Execute() (err int) {
 	// mem instructions
 	case OpLDR:
 		// Rd = dmem[Rs + sext(IMM6)]
-		Lc4.Reg[insn.Rd] = Lc4.Mem[uint16(int16(insn.Rs)+insn.Imm)]
+		dmemAddr, _ := insn.DataAddr()
+		Lc4.Reg[insn.Rd] = Lc4.Mem[dmemAddr]
 		setNzp(int16(Lc4.Reg[insn.Rd]))
 		Lc4.Pc += 1
 	case OpSTR:
 		// dmem[Rs + sext(IMM6)] = Rt
-		dmemAddr := uint16(int16(insn.Rs) + insn.Imm)
-
-		// only write to data sections
-		if (USER_DATA_START <= dmemAddr) && (dmemAddr <= USER_DATA_END) {
+		dmemAddr, _ := insn.DataAddr()
+		if Writable(dmemAddr) {
 			Lc4.Mem[dmemAddr] = Lc4.Reg[insn.Rt]
-		} else if (OS_DATA_END <= dmemAddr) && (dmemAddr <= OS_DATA_END) {
-			// only write to os data if enough privilege
-			if (Lc4.Psr & 0x8000) == 0 {
-				Lc4.Mem[dmemAddr] = Lc4.Reg[insn.Rt]
-			}
 		}
 
 		Lc4.Pc += 1
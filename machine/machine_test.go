@@ -9,7 +9,7 @@ func TestGetSignExtNPos(t *testing.T) {
 	//                    |   |   |   |   |
 	var testData uint16 = 0b1010101010101010
 	var expected uint16 = 0b0000000010101010
-	var actual uint16 = getSignExtN(testData, nBits)
+	var actual uint16 = uint16(signExtN(testData, nBits))
 	if actual != expected {
 		t.Error("Sign extension failed for positive int. Expected", expected, "but got", actual)
 	}
@@ -20,8 +20,119 @@ func TestGetSignExtNNeg(t *testing.T) {
 	//                    |   |   |   |   |
 	var testData uint16 = 0b0101010101010101
 	var expected uint16 = 0b1111111101010101
-	var actual uint16 = getSignExtN(testData, nBits)
+	var actual uint16 = uint16(signExtN(testData, nBits))
 	if actual != expected {
 		t.Error("Sign extension failed for negative int. Expected", expected, "but got", actual)
 	}
 }
+
+func TestDecodeImmediates(t *testing.T) {
+	tests := []struct {
+		word uint16
+		op   Op
+		rd   uint8
+		rs   uint8
+		imm  int16
+	}{
+		// ADD R1, R1, #-1
+		{0x127F, OpADDI, 1, 1, -1},
+		// CONST R4, #-1
+		{0x99FF, OpCONST, 4, 0, -1},
+		// HICONST R4, #255
+		{0xD9FF, OpHICONST, 4, 0, 255},
+		// CMPI R1, #-1
+		{0x237F, OpCMPI, 0, 1, -1},
+		// CMPIU R1, #65
+		{0x23C1, OpCMPIU, 0, 1, 65},
+	}
+
+	for _, test := range tests {
+		Lc4.Mem[0] = test.word
+		insn := Decode(0)
+		if insn.OpName != test.op || insn.Rd != test.rd || insn.Rs != test.rs || insn.Imm != test.imm {
+			t.Errorf("Decoding 0x%04X failed. Expected %s R%d, R%d, #%d but got %s R%d, R%d, #%d",
+				test.word, test.op, test.rd, test.rs, test.imm, insn.OpName, insn.Rd, insn.Rs, insn.Imm)
+		}
+	}
+}
+
+func TestDecodeAsm(t *testing.T) {
+	words := map[uint16]string{
+		0x0000: "NOP",
+		0x0FFB: "BRnzp #-5",
+		0x127F: "ADD R1, R1, #-1",
+		0x1480: "ADD R2, R2, R0",
+		0x9400: "CONST R2, #0",
+		0x99FF: "CONST R4, #-1",
+		0xD9FF: "HICONST R4, #255",
+		0x23C1: "CMPIU R1, #65",
+		0x6FBF: "LDR R7, R6, #-1",
+		0xC1C0: "JMPR R7",
+		0xF025: "TRAP x25",
+		0x3000: ".FILL x3000",
+	}
+
+	for word, expected := range words {
+		Lc4.Mem[0] = word
+		if actual := Decode(0).Asm(); actual != expected {
+			t.Errorf("Disassembly of 0x%04X failed. Expected %s but got %s", word, expected, actual)
+		}
+	}
+}
+
+func TestDecodeTarget(t *testing.T) {
+	Lc4.Mem[0x0005] = 0x0FFB
+	if target, ok := Decode(0x0005).Target(0x0005); !ok || target != 0x0001 {
+		t.Errorf("Branch target failed. Expected 0x0001 but got 0x%04X", target)
+	}
+
+	Lc4.Mem[0x8000] = 0x4801
+	if target, ok := Decode(0x8000).Target(0x8000); !ok || target != 0x8010 {
+		t.Errorf("JSR target failed. Expected 0x8010 but got 0x%04X", target)
+	}
+}
+
+func TestExecuteLoadStore(t *testing.T) {
+	Lc4.Pc = 0x0000
+	Lc4.Psr = 0
+	Lc4.Reg[1] = 0x2001
+	Lc4.Reg[2] = 0x1234
+
+	// STR R2, R1, #-1
+	// LDR R3, R1, #-1
+	Lc4.Mem[0x0000] = 0x747F
+	Lc4.Mem[0x0001] = 0x667F
+
+	Execute()
+	if Lc4.Mem[0x2000] != 0x1234 {
+		t.Errorf("STR failed. Expected 0x1234 at 0x2000 but got 0x%04X", Lc4.Mem[0x2000])
+	}
+
+	Execute()
+	if Lc4.Reg[3] != 0x1234 {
+		t.Errorf("LDR failed. Expected R3 = 0x1234 but got 0x%04X", Lc4.Reg[3])
+	}
+}
+
+func TestExecuteBranchOnCondition(t *testing.T) {
+	Lc4.Pc = 0x0000
+	Lc4.Psr = 0
+	Lc4.Reg[1] = 0
+
+	// ADD R1, R1, #-1
+	// BRn #2
+	// BRz #5
+	Lc4.Mem[0x0000] = 0x127F
+	Lc4.Mem[0x0001] = 0x0802
+	Lc4.Mem[0x0002] = 0x0405
+
+	Execute()
+	if Lc4.Psr&0b111 != 0b100 || Nzp() != -1 {
+		t.Errorf("Expected n to be set, but got PSR = 0x%04X", Lc4.Psr)
+	}
+
+	Execute()
+	if Lc4.Pc != 0x0004 {
+		t.Errorf("BRn not taken. Expected PC = 0x0004 but got 0x%04X", Lc4.Pc)
+	}
+}
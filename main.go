@@ -2,23 +2,41 @@ package main
 
 import (
 	"fmt"
-	"github.com/chzyer/readline"
+	"github.com/hryoma/lc4go/assembler"
+	"github.com/hryoma/lc4go/dap"
 	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/gdbserver"
+	"github.com/hryoma/lc4go/jsonrpc"
+	"github.com/hryoma/lc4go/linker"
+	"github.com/hryoma/lc4go/tokenizer"
+	"github.com/hryoma/lc4go/web"
 	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+var backtraceCmd = &cobra.Command{
+	Use:     "backtrace",
+	Short:   "Print the call stack",
+	Aliases: []string{"bt", "where"},
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.Backtrace()
+	},
+}
+
 var breakpointCmd = &cobra.Command{
 	Use:     "breakpoint",
-	Short:   "Set a breakpoint in the code",
+	Short:   "Set a breakpoint at an address or label",
 	Aliases: []string{"b"},
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
+		if len(args) == 0 {
 			fmt.Println("Invalid number of arguments provided")
 			return
 		}
 
-		emulator.Breakpoint(args[0])
+		emulator.SetBreakpoint(strings.Join(args, " "))
 	},
 }
 
@@ -40,35 +58,245 @@ var continueCmd = &cobra.Command{
 	},
 }
 
+var deleteCmd = &cobra.Command{
+	Use:     "delete",
+	Short:   "Delete the numbered breakpoints, or all breakpoints",
+	Aliases: []string{"d"},
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.DeleteBreakpoints(args)
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable the numbered breakpoints, or all breakpoints",
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.DisableBreakpoints(args)
+	},
+}
+
+var displayCmd = &cobra.Command{
+	Use:   "display",
+	Short: "Print an expression every time execution stops: display/<fmt> <expr>",
+	// expressions may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := ""
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			spec = args[0]
+			args = args[1:]
+		}
+
+		if len(args) == 0 {
+			emulator.InfoDisplay()
+			return
+		}
+		emulator.AddDisplay(spec, strings.Join(args, " "))
+	},
+}
+
+var dprintfCmd = &cobra.Command{
+	Use:   "dprintf",
+	Short: "Print a message whenever an address is reached, without stopping: dprintf <addr>, \"fmt\", args...",
+	// arguments may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetDprintf(strings.Join(args, " "))
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <expr>",
+	Short: "Stop whenever the value of an expression changes",
+	// expressions may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetWatchpoint(strings.Join(args, " "))
+	},
+}
+
+var dumpObjCmd = &cobra.Command{
+	Use:   "dump-obj <start> <end> <file>",
+	Short: "Save memory from start to end, inclusive, to an object file",
+	// addresses may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 3 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.DumpObj(args[0], args[1], args[2])
+	},
+}
+
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Select the frame called by the current frame",
+	Run: func(cmd *cobra.Command, args []string) {
+		if count, ok := parseCount(args); ok {
+			emulator.Down(count)
+		}
+	},
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable the numbered breakpoints, or all breakpoints",
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.EnableBreakpoints(args)
+	},
+}
+
+var examineCmd = &cobra.Command{
+	Use:   "x",
+	Short: "Examine memory: x/<count><fmt> <addr>, with fmt one of x, d, u, t, c, i",
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := ""
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			spec = args[0]
+			args = args[1:]
+		}
+
+		emulator.Examine(spec, strings.Join(args, " "))
+	},
+}
+
+var findCmd = &cobra.Command{
+	Use:   "find",
+	Short: "Search memory for a value, a sequence of values, or a \"string\"",
+	// values may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.Find(args[0], args[1], args[2:])
+	},
+}
+
+var finishCmd = &cobra.Command{
+	Use:     "finish",
+	Short:   "Run until the selected subroutine returns",
+	Aliases: []string{"fin"},
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.Finish()
+	},
+}
+
+var ignoreCmd = &cobra.Command{
+	Use:   "ignore",
+	Short: "Skip the next crossings of a breakpoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.IgnoreBreakpoint(args[0], args[1])
+	},
+}
+
+var infoCmd = &cobra.Command{
+	Use:     "info",
+	Short:   "Show information about the debugger state",
+	Aliases: []string{"i"},
+}
+
+var infoDisplayCmd = &cobra.Command{
+	Use:   "display",
+	Short: "List all auto-display expressions",
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.InfoDisplay()
+	},
+}
+
+var infoBreakpointsCmd = &cobra.Command{
+	Use:     "breakpoints",
+	Short:   "List all breakpoints",
+	Aliases: []string{"b", "break"},
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.InfoBreakpoints()
+	},
+}
+
 var loadCmd = &cobra.Command{
-	Use:     "load",
-	Short:   "Load a file",
+	Use:     "load [file]",
+	Short:   "Load an object file, or assemble and load a .asm file",
 	Aliases: []string{"l"},
+	Args:    cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fileName, err := cmd.Flags().GetString("obj")
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			emulator.Load(fileName)
+		objFile, _ := cmd.Flags().GetString("obj")
+		asmFile, _ := cmd.Flags().GetString("asm")
+		strict, _ := cmd.Flags().GetBool("strict")
+		// flags keep their values between commands
+		cmd.Flags().Set("obj", "")
+		cmd.Flags().Set("asm", "")
+		cmd.Flags().Set("strict", "false")
+		if strict {
+			policy := tokenizer.LoadPolicy
+			tokenizer.LoadPolicy = tokenizer.StrictPolicy
+			defer func() {
+				tokenizer.LoadPolicy = policy
+			}()
+		}
+		if objFile != "" {
+			if err := emulator.LoadObj(objFile); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if asmFile != "" {
+			if err := emulator.LoadAsm(asmFile); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if len(args) > 0 {
+			if err := emulator.Load(args[0]); err != nil {
+				fmt.Println(err)
+			}
+		} else if objFile == "" && asmFile == "" {
+			fmt.Println("Invalid number of arguments provided")
 		}
 	},
 }
 
 var nextCmd = &cobra.Command{
-	Use:     "next",
-	Short:   "Run until the program counter reaches PC + 1",
+	Use:     "next [count]",
+	Short:   "Execute count instructions, or one, stepping over subroutine calls",
 	Aliases: []string{"n"},
+	Args:    cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		emulator.Next()
+		if count, ok := parseCount(args); ok {
+			emulator.Next(count)
+		}
 	},
 }
 
 var printCmd = &cobra.Command{
 	Use:     "print",
-	Short:   "Print register values, PSR bits, code lines, or content in memory",
+	Short:   "Print register values, PSR bits, code lines, content in memory, or an expression",
 	Aliases: []string{"p"},
+	// expressions may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		emulator.Print()
+		if len(args) == 0 {
+			emulator.Print()
+			return
+		}
+
+		emulator.PrintExpr(strings.Join(args, " "))
 	},
 }
 
@@ -86,12 +314,12 @@ var printMemCmd = &cobra.Command{
 	Short:   "Print content in memory",
 	Aliases: []string{"m"},
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
+		if len(args) == 0 {
 			fmt.Println("Invalid number of arguments provided")
 			return
 		}
 
-		emulator.PrintMem(args[0])
+		emulator.PrintMem(strings.Join(args, " "))
 	},
 }
 
@@ -113,6 +341,32 @@ var printRegCmd = &cobra.Command{
 	},
 }
 
+var addSafePathCmd = &cobra.Command{
+	Use:   "add-auto-load-safe-path <dir>",
+	Short: "Trust the .lc4gorc files in a directory and the directories below it",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		addSafePath(args[0])
+	},
+}
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Run REPL commands from a file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		sourceFile(args[0])
+	},
+}
+
 var runCmd = &cobra.Command{
 	Use:     "run",
 	Short:   "Run the file from the beginning",
@@ -130,27 +384,403 @@ var resetCmd = &cobra.Command{
 	},
 }
 
+var setCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Modify register values, memory, the PC or the PSR",
+}
+
+var setMemCmd = &cobra.Command{
+	Use:     "mem",
+	Short:   "Set the value stored in memory",
+	Aliases: []string{"m"},
+	// values may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetMem(args[0], strings.Join(args[1:], " "))
+	},
+}
+
+var setNzpCmd = &cobra.Command{
+	Use:   "nzp",
+	Short: "Set the condition code to n, z or p",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetNzp(args[0])
+	},
+}
+
+var setPcCmd = &cobra.Command{
+	Use:   "pc",
+	Short: "Set the program counter",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetPc(strings.Join(args, " "))
+	},
+}
+
+var setPsrCmd = &cobra.Command{
+	Use:   "psr",
+	Short: "Set the PSR, or only its privilege bit with 'psr priv'",
+	// values may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		switch len(args) {
+		case 1:
+			emulator.SetPsr("", args[0])
+		case 2:
+			emulator.SetPsr(args[0], args[1])
+		default:
+			fmt.Println("Invalid number of arguments provided")
+		}
+	},
+}
+
+var setRegCmd = &cobra.Command{
+	Use:     "reg",
+	Short:   "Set a register value",
+	Aliases: []string{"r"},
+	// values may be negative, so don't treat them as flags
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetReg(args[0], strings.Join(args[1:], " "))
+	},
+}
+
 var stepCmd = &cobra.Command{
-	Use:     "step",
-	Short:   "Execute one instruction",
+	Use:     "step [count]",
+	Short:   "Execute count instructions, or one",
 	Aliases: []string{"s"},
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if count, ok := parseCount(args); ok {
+			emulator.Step(count)
+		}
+	},
+}
+
+var tbreakCmd = &cobra.Command{
+	Use:   "tbreak",
+	Short: "Set a breakpoint that is deleted after it is hit",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("Invalid number of arguments provided")
+			return
+		}
+
+		emulator.SetTempBreakpoint(strings.Join(args, " "))
+	},
+}
+
+var undisplayCmd = &cobra.Command{
+	Use:   "undisplay",
+	Short: "Delete the numbered auto-display expressions, or all of them",
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator.Undisplay(args)
+	},
+}
+
+var upCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Select the frame that called the current frame",
 	Run: func(cmd *cobra.Command, args []string) {
-		emulator.Step()
+		if count, ok := parseCount(args); ok {
+			emulator.Up(count)
+		}
 	},
 }
 
 var rootCmd = &cobra.Command{}
 
+var asCmd = &cobra.Command{
+	Use:   "as <asm file>",
+	Short: "Assemble a source file into an object file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prog, err := assembler.AssembleFile(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		out, _ := cmd.Flags().GetString("output")
+		if out == "" {
+			out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".obj"
+		}
+		if err := prog.WriteObjFile(out); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if listing, _ := cmd.Flags().GetString("listing"); listing != "" {
+			if err := prog.WriteListingFile(listing); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+var dapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "Serve the Debug Adapter Protocol over stdio, or TCP with --listen",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if addr, _ := cmd.Flags().GetString("listen"); addr != "" {
+			if err := dap.ListenAndServe(addr); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+
+		// stdout carries the protocol, so send everything else to stderr
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		dap.NewSession(os.Stdin, out).Serve()
+	},
+}
+
+var objdumpCmd = &cobra.Command{
+	Use:   "objdump <obj file>",
+	Short: "Describe the records of an object file, and disassemble its code",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		// a bad file is reported at the end of the dump
+		if err := tokenizer.Objdump(os.Stdout, file); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+var linkCmd = &cobra.Command{
+	Use:   "link <obj files...>",
+	Short: "Link object files into one, filling in references between them",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prog, err := linker.LinkFiles(args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		out, _ := cmd.Flags().GetString("output")
+		if err := prog.WriteObjFile(out); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Serve line-delimited JSON-RPC over stdio, or a Unix socket with --socket",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if path, _ := cmd.Flags().GetString("socket"); path != "" {
+			if err := jsonrpc.ListenAndServe(path); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+
+		// stdout carries the responses, so send everything else to stderr
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		if err := jsonrpc.Serve(os.Stdin, out); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Start the REPL in a full screen terminal interface",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		noRc, _ := cmd.Flags().GetBool("nx")
+		scripts, _ := cmd.Flags().GetStringArray("command")
+		runTui(!noRc, scripts)
+	},
+}
+
+var webCmd = &cobra.Command{
+	Use:   "web [obj files...]",
+	Short: "Load object files and serve a browser debugger",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, fileName := range args {
+			if err := emulator.Load(fileName); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		addr, _ := cmd.Flags().GetString("listen")
+		if err := web.ListenAndServe(addr); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var gdbserverCmd = &cobra.Command{
+	Use:   "gdbserver <addr> [obj files...]",
+	Short: "Load object files and serve the machine over the GDB Remote Serial Protocol",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, fileName := range args[1:] {
+			if err := emulator.Load(fileName); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		if err := gdbserver.ListenAndServe(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var cliCmd = &cobra.Command{
+	Use:   "lc4go",
+	Short: "LC4 ISA emulator",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		noRc, _ := cmd.Flags().GetBool("nx")
+		scripts, _ := cmd.Flags().GetStringArray("command")
+		runShell(!noRc, scripts)
+	},
+}
+
+// splitArgs splits a line on whitespace, keeping double quoted strings
+// together with their quotes
+func splitArgs(line string) (args []string) {
+	var arg strings.Builder
+	inArg, inQuote, escaped := false, false, false
+
+	for _, char := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && char == '\\':
+			escaped = true
+		case char == '"':
+			inQuote = !inQuote
+		case !inQuote && (char == ' ' || char == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+			continue
+		}
+
+		arg.WriteRune(char)
+		inArg = true
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return
+}
+
+// splitFormat turns a command like x/4x into the command name followed by
+// its /4x format argument
+func splitFormat(args []string) []string {
+	name, format, found := strings.Cut(args[0], "/")
+	if !found || name == "" {
+		return args
+	}
+
+	return append([]string{name, "/" + format}, args[1:]...)
+}
+
+// repeatArgs returns the command that an empty line repeats, if any. Stepping
+// commands repeat as-is, and x continues from where it left off.
+func repeatArgs(args []string) []string {
+	cmd, _, err := rootCmd.Find(splitFormat(args))
+	if err != nil {
+		return nil
+	}
+
+	switch cmd {
+	case stepCmd, nextCmd:
+		return args
+	case examineCmd:
+		return args[:1]
+	}
+	return nil
+}
+
+// parseCount reads an optional repeat count, defaulting to 1
+func parseCount(args []string) (count int, ok bool) {
+	if len(args) == 0 {
+		return 1, true
+	} else if len(args) > 1 {
+		fmt.Println("Invalid number of arguments provided")
+		return 0, false
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		fmt.Println("Invalid count:", args[0])
+		return 0, false
+	}
+	return count, true
+}
+
 func init() {
 	// initialize state
 	emulator.Clear()
 
 	// register commands
+	rootCmd.AddCommand(addSafePathCmd)
+	rootCmd.AddCommand(backtraceCmd)
 	rootCmd.AddCommand(breakpointCmd)
 	rootCmd.AddCommand(clearCmd)
+	rootCmd.AddCommand(commandsCmd)
 	rootCmd.AddCommand(continueCmd)
+	rootCmd.AddCommand(defineCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(disableCmd)
+	rootCmd.AddCommand(displayCmd)
+	rootCmd.AddCommand(downCmd)
+	rootCmd.AddCommand(dprintfCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(dumpObjCmd)
+	rootCmd.AddCommand(enableCmd)
+	rootCmd.AddCommand(examineCmd)
+	rootCmd.AddCommand(findCmd)
+	rootCmd.AddCommand(finishCmd)
+	rootCmd.AddCommand(ignoreCmd)
+	rootCmd.AddCommand(infoCmd)
+	infoCmd.AddCommand(infoBreakpointsCmd)
+	infoCmd.AddCommand(infoDisplayCmd)
 	rootCmd.AddCommand(loadCmd)
 	loadCmd.Flags().StringP("obj", "b", "", "Input object file path")
+	loadCmd.Flags().StringP("asm", "a", "", "Input assembly file path")
+	loadCmd.Flags().Bool("strict", false, "Refuse object files with any problems, instead of warning")
 	rootCmd.AddCommand(nextCmd)
 	rootCmd.AddCommand(printCmd)
 	printCmd.AddCommand(printCodeCmd)
@@ -159,32 +789,41 @@ func init() {
 	printCmd.AddCommand(printRegCmd)
 	rootCmd.AddCommand(resetCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(setCmd)
+	setCmd.AddCommand(setMemCmd)
+	setCmd.AddCommand(setNzpCmd)
+	setCmd.AddCommand(setPcCmd)
+	setCmd.AddCommand(setPsrCmd)
+	setCmd.AddCommand(setRegCmd)
+	rootCmd.AddCommand(sourceCmd)
 	rootCmd.AddCommand(stepCmd)
-}
-
-func main() {
-	fmt.Println("LC4 ISA Emulator")
+	rootCmd.AddCommand(tbreakCmd)
+	rootCmd.AddCommand(undisplayCmd)
+	rootCmd.AddCommand(upCmd)
 
-	// initialize shell
-	shell, err := readline.NewEx(&readline.Config{
-		Prompt:    "lc4> ",
-		EOFPrompt: "exit",
-	})
-	if err != nil {
-		panic(err)
-	}
-	defer shell.Close()
+	// register top level commands
+	cliCmd.AddCommand(asCmd)
+	asCmd.Flags().StringP("output", "o", "", "Output object file path (default: the source path with .obj)")
+	asCmd.Flags().StringP("listing", "l", "", "Also write a listing file with addresses, encodings and symbols")
+	cliCmd.AddCommand(dapCmd)
+	dapCmd.Flags().String("listen", "", "Serve over TCP on this address instead of stdio")
+	cliCmd.AddCommand(gdbserverCmd)
+	cliCmd.AddCommand(linkCmd)
+	linkCmd.Flags().StringP("output", "o", "out.obj", "Output object file path")
+	cliCmd.AddCommand(objdumpCmd)
+	cliCmd.AddCommand(rpcCmd)
+	rpcCmd.Flags().String("socket", "", "Serve on this Unix socket instead of stdio")
+	cliCmd.AddCommand(tuiCmd)
+	tuiCmd.Flags().StringArrayP("command", "x", nil, "Execute REPL commands from a script file")
+	tuiCmd.Flags().BoolP("nx", "n", false, "Do not read .lc4gorc files")
+	cliCmd.AddCommand(webCmd)
+	webCmd.Flags().String("listen", "localhost:8080", "Address to serve on")
 
-	// i/o loop
-	for {
-		line, err := shell.Readline()
-		if err != nil {
-			break
-		}
+	// register startup flags
+	cliCmd.Flags().StringArrayP("command", "x", nil, "Execute REPL commands from a script file")
+	cliCmd.Flags().BoolP("nx", "n", false, "Do not read .lc4gorc files")
+}
 
-		if args := strings.Fields(line); len(args) != 0 {
-			rootCmd.SetArgs(args)
-			rootCmd.Execute()
-		}
-	}
+func main() {
+	cliCmd.Execute()
 }
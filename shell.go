@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/hryoma/lc4go/emulator"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const RC_FILE_NAME = ".lc4gorc"
+const MAX_NEST_DEPTH = 16
+
+// the depth of nested scripts and user-defined commands
+var nestDepth int
+
+// set while breakpoint command lists run, so they only run from the top level
+var inStopCommands bool
+
+// runShell reads the rc files and startup scripts, then starts the REPL
+func runShell(readRc bool, scripts []string) {
+	fmt.Println("LC4 ISA Emulator")
+	startup(readRc, scripts)
+
+	shell := newShell()
+	defer shell.Close()
+	readCommands(shell, runArgs)
+}
+
+// startup sources the rc files, unless readRc is false, then the scripts
+func startup(readRc bool, scripts []string) {
+	if readRc {
+		sourceRcFiles()
+	}
+	for _, script := range scripts {
+		sourceFile(script)
+	}
+}
+
+func newShell() *readline.Instance {
+	shell, err := readline.NewEx(&readline.Config{
+		Prompt:    "lc4> ",
+		EOFPrompt: "exit",
+	})
+	if err != nil {
+		panic(err)
+	}
+	return shell
+}
+
+// readCommands reads lines until EOF, collecting blocks and passing each
+// command to exec
+func readCommands(shell *readline.Instance, exec func(args []string)) {
+	var lastArgs []string
+	for {
+		if pendingBlock != nil {
+			shell.SetPrompt(">")
+		} else {
+			shell.SetPrompt("lc4> ")
+		}
+
+		line, err := shell.Readline()
+		if err != nil {
+			break
+		}
+
+		if pendingBlock != nil {
+			collectLine(line)
+			continue
+		}
+
+		args := splitArgs(line)
+		if isComment(args) {
+			continue
+		} else if len(args) == 0 {
+			// an empty line repeats the last command, if it can be repeated
+			if lastArgs == nil {
+				continue
+			}
+			args = repeatArgs(lastArgs)
+			if args == nil {
+				continue
+			}
+		}
+		lastArgs = args
+
+		exec(args)
+	}
+}
+
+// feedLine runs a line of input, or adds it to the block being defined
+func feedLine(line string) {
+	if pendingBlock != nil {
+		collectLine(line)
+		return
+	}
+
+	execLine(line)
+}
+
+// execLine runs one line of REPL commands, skipping blank lines and comments
+func execLine(line string) {
+	args := splitArgs(line)
+	if len(args) == 0 || isComment(args) {
+		return
+	}
+
+	runArgs(args)
+}
+
+// isComment reports whether a line of arguments is a # comment, which is
+// skipped wherever commands are read
+func isComment(args []string) bool {
+	return len(args) > 0 && strings.HasPrefix(args[0], "#")
+}
+
+func runArgs(args []string) {
+	rootCmd.SetArgs(splitFormat(args))
+	rootCmd.Execute()
+
+	if !inStopCommands {
+		runStopCommands()
+	}
+}
+
+// runStopCommands runs the command list of the breakpoint that stopped
+// execution, and again for every stop those commands cause
+func runStopCommands() {
+	inStopCommands = true
+	defer func() {
+		inStopCommands = false
+	}()
+
+	for lines := emulator.TakeStopCommands(); lines != nil; lines = emulator.TakeStopCommands() {
+		for _, line := range lines {
+			execLine(line)
+		}
+	}
+}
+
+// sourceFile runs every line of a script as a REPL command
+func sourceFile(fileName string) {
+	if nestDepth >= MAX_NEST_DEPTH {
+		fmt.Println("Scripts nested too deeply, not sourcing", fileName)
+		return
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		fmt.Println("File not found:", fileName)
+		return
+	}
+	defer file.Close()
+
+	nestDepth++
+	defer func() {
+		nestDepth--
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		feedLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println("Could not read script:", err)
+	}
+
+	// blocks can't span files
+	if pendingBlock != nil {
+		fmt.Println("Missing end in", fileName)
+		pendingBlock = nil
+	}
+}
+
+// directories whose .lc4gorc files are trusted, besides the home directory,
+// added with add-auto-load-safe-path
+var safePaths []string
+
+// addSafePath trusts the .lc4gorc files in dir and the directories below it
+func addSafePath(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	safePaths = append(safePaths, filepath.Clean(dir))
+}
+
+// isSafePath reports whether dir is a safe path, or below one
+func isSafePath(dir string) bool {
+	for _, safePath := range safePaths {
+		rel, err := filepath.Rel(safePath, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceRcFiles sources ~/.lc4gorc and then ./.lc4gorc, if they exist. A
+// project's ./.lc4gorc could come from anywhere, so it is only sourced if
+// ~/.lc4gorc has marked its directory safe with add-auto-load-safe-path.
+func sourceRcFiles() {
+	home, err := os.UserHomeDir()
+	if err == nil {
+		if rcFile := filepath.Join(home, RC_FILE_NAME); fileExists(rcFile) {
+			sourceFile(rcFile)
+		}
+	}
+
+	wd, err := os.Getwd()
+	// don't source the same file twice when running from the home directory
+	if err != nil || wd == home {
+		return
+	}
+	rcFile := filepath.Join(wd, RC_FILE_NAME)
+	if !fileExists(rcFile) {
+		return
+	} else if !isSafePath(wd) {
+		fmt.Printf("Not sourcing %s, as %s is not a safe path.\n", rcFile, wd)
+		fmt.Printf("To trust it, add \"add-auto-load-safe-path %s\" to ~/%s\n", wd, RC_FILE_NAME)
+		return
+	}
+	sourceFile(rcFile)
+}
+
+func fileExists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return err == nil
+}
@@ -0,0 +1,218 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"strings"
+)
+
+// Check is a problem Load looks for in the blocks of an object file
+type Check int
+
+const (
+	// a code block in a data region of memory, or a data block in a code region
+	CHECK_REGION Check = iota
+	// a block that runs past xFFFF, and wraps around to x0000
+	CHECK_WRAP
+	// a block that shares addresses with a block already loaded
+	CHECK_OVERLAP
+	// a line record whose file index is past the object file's file names
+	CHECK_LINE
+)
+
+// Severity says whether Load warns about a problem, or refuses to load the file
+type Severity int
+
+const (
+	IGNORE Severity = iota
+	WARN
+	ERROR
+)
+
+// Policy gives the severity of each check. Unknown records and truncated
+// files are always errors.
+type Policy map[Check]Severity
+
+var DefaultPolicy = Policy{
+	CHECK_REGION:  WARN,
+	CHECK_WRAP:    ERROR,
+	CHECK_OVERLAP: WARN,
+	CHECK_LINE:    ERROR,
+}
+
+var StrictPolicy = Policy{
+	CHECK_REGION:  ERROR,
+	CHECK_WRAP:    ERROR,
+	CHECK_OVERLAP: ERROR,
+	CHECK_LINE:    ERROR,
+}
+
+// LoadPolicy is the policy TokenizeObj loads with
+var LoadPolicy = DefaultPolicy
+
+// ErrorList holds every error found in an object file
+type ErrorList []error
+
+func (errs ErrorList) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Load reads an object file and loads it into the machine, see LoadProgram
+func Load(r io.Reader, name string, policy Policy) (warnings []error, err error) {
+	prog, err := Parse(r)
+	if err != nil {
+		return nil, ErrorList{err}
+	}
+	return LoadProgram(prog, name, policy)
+}
+
+// LoadProgram checks a program against policy, and loads it into the machine
+// if none of the problems found are errors. name is the file the blocks are
+// recorded as coming from. The problems that are warnings are returned either
+// way, and err is an ErrorList of the rest.
+func LoadProgram(prog *Program, name string, policy Policy) (warnings []error, err error) {
+	var errs ErrorList
+	report := func(check Check, offset int64, format string, args ...interface{}) {
+		problem := atOffset(offset, fmt.Sprintf(format, args...))
+		switch policy[check] {
+		case WARN:
+			warnings = append(warnings, problem)
+		case ERROR:
+			errs = append(errs, problem)
+		}
+	}
+
+	// reloading a file replaces its blocks, so they aren't overlaps
+	var blocks, loaded []machine.Block
+	for _, block := range machine.Lc4.Blocks {
+		if block.File != name {
+			loaded = append(loaded, block)
+		}
+	}
+	for _, seg := range prog.Segments {
+		if len(seg.Words) == 0 {
+			continue
+		}
+		block := machine.Block{Addr: seg.Addr, Len: len(seg.Words), Data: seg.Data, File: name}
+		desc := describeBlock(block)
+
+		if end := int(block.Addr) + block.Len; end > machine.MEM_SIZE {
+			report(CHECK_WRAP, seg.Offset, "%s wraps past xFFFF to x%04X", desc, end-1-machine.MEM_SIZE)
+		}
+
+		for i := 0; i < block.Len; i++ {
+			addr := int(block.Addr + uint16(i))
+			if isData(addr) == block.Data {
+				continue
+			}
+			region := "code"
+			if isData(addr) {
+				region = "data"
+			}
+			if i == 0 {
+				report(CHECK_REGION, seg.Offset, "%s is in a %s region", desc, region)
+			} else {
+				report(CHECK_REGION, seg.Offset, "%s runs into the %s region at x%04X", desc, region, addr)
+			}
+			break
+		}
+
+		for _, prev := range loaded {
+			if overlaps(block, prev) {
+				report(CHECK_OVERLAP, seg.Offset, "%s overlaps %s loaded from %s", desc, describeBlock(prev), prev.File)
+			}
+		}
+		loaded = append(loaded, block)
+		blocks = append(blocks, block)
+	}
+
+	// lines with a bad file index are skipped if they aren't errors
+	var lines []Line
+	for _, line := range prog.Lines {
+		if int(line.FileIdx) >= len(prog.Files) {
+			report(CHECK_LINE, line.Offset, "line %d at x%04X names file %d, but there are only %d file names",
+				line.Line, line.Addr, line.FileIdx, len(prog.Files))
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if len(errs) > 0 {
+		return warnings, errs
+	}
+
+	machine.SetBlocks(name, blocks)
+	machine.ForgetFile(name)
+	for _, seg := range prog.Segments {
+		for i, word := range seg.Words {
+			machine.Lc4.Mem[seg.Addr+uint16(i)] = word
+		}
+	}
+	if machine.Lc4.LabelSources == nil {
+		machine.Lc4.LabelSources = map[string]string{}
+	}
+	for _, label := range prog.SymbolNames() {
+		addr := prog.Symbols[label]
+		machine.Lc4.Labels[label] = addr
+		machine.Lc4.LabelSources[label] = name
+		meta := machine.Lc4.Meta[addr]
+		meta.Label = label
+		machine.Lc4.Meta[addr] = meta
+	}
+
+	// file indices are local to each object file
+	fileBase := len(machine.Lc4.Files)
+	for len(machine.Lc4.FileSources) < fileBase {
+		machine.Lc4.FileSources = append(machine.Lc4.FileSources, "")
+	}
+	machine.Lc4.FileSources = machine.Lc4.FileSources[:fileBase]
+	machine.Lc4.Files = append(machine.Lc4.Files, prog.Files...)
+	for range prog.Files {
+		machine.Lc4.FileSources = append(machine.Lc4.FileSources, name)
+	}
+	for _, line := range lines {
+		meta := machine.Lc4.Meta[line.Addr]
+		meta.Line = line.Line
+		meta.File = fileBase + int(line.FileIdx)
+		machine.Lc4.Meta[line.Addr] = meta
+	}
+
+	for _, reloc := range prog.Relocs {
+		warnings = append(warnings, atOffset(reloc.RecordOffset, fmt.Sprintf(
+			"unresolved reference to %s at x%04X, link the object file first", reloc.Symbol, reloc.Addr)))
+	}
+	return warnings, nil
+}
+
+// atOffset returns a *FormatError at offset, or a plain error for a program
+// that wasn't read from a file
+func atOffset(offset int64, msg string) error {
+	if offset < 0 {
+		return errors.New(msg)
+	}
+	return &FormatError{offset, msg}
+}
+
+// describeBlock formats the kind and addresses of a block
+func describeBlock(block machine.Block) string {
+	kind := "code"
+	if block.Data {
+		kind = "data"
+	}
+	return fmt.Sprintf("%s block x%04X-x%04X", kind, block.Addr, uint16(int(block.Addr)+block.Len-1))
+}
+
+// overlaps reports whether two blocks share an address, including blocks
+// that wrap past xFFFF
+func overlaps(a machine.Block, b machine.Block) bool {
+	within := func(addr uint16, block machine.Block) bool {
+		return int(addr-block.Addr) < block.Len
+	}
+	return within(a.Addr, b) || within(b.Addr, a)
+}
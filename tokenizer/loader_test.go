@@ -0,0 +1,209 @@
+package tokenizer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/hryoma/lc4go/machine"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	clearMachine()
+	obj := objBytes(t, func(w *Writer) {
+		w.Code(0x0000, []uint16{0x9005, 0x103F})
+		w.Data(0x4000, []uint16{7})
+		w.Symbol(0x0000, "MAIN")
+		w.File("main.asm")
+		w.Line(0x0001, 4, 0)
+	})
+
+	warnings, err := Load(bytes.NewReader(obj), "main.obj", DefaultPolicy)
+	if err != nil || len(warnings) != 0 {
+		t.Fatal("Unexpected problems:", warnings, err)
+	}
+	if machine.Lc4.Mem[0x0001] != 0x103F || machine.Lc4.Mem[0x4000] != 7 {
+		t.Error("Blocks not loaded")
+	}
+	if machine.Lc4.Labels["MAIN"] != 0 || machine.Lc4.Meta[0x0001].Line != 4 || machine.Lc4.Files[0] != "main.asm" {
+		t.Error("Symbols and lines not loaded")
+	}
+	if len(machine.Lc4.Blocks) != 2 || machine.Lc4.Blocks[1] != (machine.Block{Addr: 0x4000, Len: 1, Data: true, File: "main.obj"}) {
+		t.Error("Unexpected blocks", machine.Lc4.Blocks)
+	}
+
+	// loading the same file again replaces its blocks
+	warnings, err = Load(bytes.NewReader(obj), "main.obj", StrictPolicy)
+	if err != nil || len(warnings) != 0 || len(machine.Lc4.Blocks) != 2 {
+		t.Error("Unexpected problems reloading:", warnings, err, machine.Lc4.Blocks)
+	}
+}
+
+func TestReloadReplacesLabelsAndFiles(t *testing.T) {
+	clearMachine()
+	load := func(name string, write func(w *Writer)) {
+		if _, err := Load(bytes.NewReader(objBytes(t, write)), name, DefaultPolicy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load("a.obj", func(w *Writer) {
+		w.Code(0x0000, []uint16{1, 2})
+		w.Symbol(0x0001, "OLD")
+		w.File("a.asm")
+		w.Line(0x0001, 3, 0)
+	})
+	load("b.obj", func(w *Writer) {
+		w.Code(0x0010, []uint16{3})
+		w.Symbol(0x0010, "B")
+		w.File("b.asm")
+		w.Line(0x0010, 5, 0)
+	})
+	load("a.obj", func(w *Writer) {
+		w.Code(0x0000, []uint16{1, 2})
+		w.Symbol(0x0000, "NEW")
+		w.File("a.asm")
+		w.Line(0x0000, 2, 0)
+	})
+
+	if _, exists := machine.Lc4.Labels["OLD"]; exists || machine.Lc4.Meta[0x0001] != (machine.MemMetadata{}) {
+		t.Error("Expected the old label and line to be dropped", machine.Lc4.Labels, machine.Lc4.Meta[0x0001])
+	}
+	if machine.Lc4.Labels["NEW"] != 0 || machine.Lc4.Labels["B"] != 0x0010 {
+		t.Error("Unexpected labels", machine.Lc4.Labels)
+	}
+	if files := machine.Lc4.Files; len(files) != 2 || files[0] != "b.asm" || files[1] != "a.asm" {
+		t.Error("Expected each file once but got", files)
+	}
+	// b's line still refers to b.asm after a.asm is renumbered
+	if meta := machine.Lc4.Meta[0x0010]; meta.Line != 5 || machine.Lc4.Files[meta.File] != "b.asm" {
+		t.Error("Unexpected line info", meta)
+	}
+	if meta := machine.Lc4.Meta[0x0000]; meta.Line != 2 || machine.Lc4.Files[meta.File] != "a.asm" {
+		t.Error("Unexpected line info", meta)
+	}
+}
+
+func TestLoadChecks(t *testing.T) {
+	clearMachine()
+	if _, err := Load(bytes.NewReader(objBytes(t, func(w *Writer) {
+		w.Code(0x0000, []uint16{1, 2, 3})
+	})), "os.obj", DefaultPolicy); err != nil {
+		t.Fatal(err)
+	}
+
+	obj := objBytes(t, func(w *Writer) {
+		w.Symbol(0x1FFF, "END")
+		w.Code(0x1FFF, []uint16{0x9005, 0x103F})
+		w.Data(0x0002, []uint16{7})
+	})
+	expected := []string{
+		"offset 0x0009: code block x1FFF-x2000 runs into the data region at x2000",
+		"offset 0x0013: data block x0002-x0002 is in a code region",
+		"offset 0x0013: data block x0002-x0002 overlaps code block x0000-x0002 loaded from os.obj",
+	}
+
+	warnings, err := Load(bytes.NewReader(obj), "main.obj", DefaultPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != len(expected) {
+		t.Fatal("Unexpected warnings:", warnings)
+	}
+	for i, warning := range warnings {
+		if warning.Error() != expected[i] {
+			t.Errorf("Expected warning %q, got %q", expected[i], warning)
+		}
+	}
+
+	// under the strict policy, nothing is loaded
+	clearMachine()
+	machine.Lc4.Blocks = []machine.Block{{Addr: 0x0000, Len: 3, File: "os.obj"}}
+	warnings, err = Load(bytes.NewReader(obj), "main.obj", StrictPolicy)
+	var errs ErrorList
+	if !errors.As(err, &errs) || len(errs) != len(expected) || len(warnings) != 0 {
+		t.Fatal("Expected every problem to be an error, got", warnings, err)
+	}
+	if machine.Lc4.Mem[0x1FFF] != 0 || len(machine.Lc4.Labels) != 0 || len(machine.Lc4.Blocks) != 1 {
+		t.Error("Object file loaded despite errors")
+	}
+
+	// blocks that wrap are errors even by default
+	_, err = Load(bytes.NewReader(objBytes(t, func(w *Writer) {
+		w.Data(0xFFFF, []uint16{1, 2})
+	})), "wrap.obj", DefaultPolicy)
+	if err == nil || err.Error() != "offset 0x0000: data block xFFFF-x0000 wraps past xFFFF to x0000" {
+		t.Error("Unexpected error:", err)
+	}
+
+	// and so are bad files
+	_, err = Load(bytes.NewReader(obj[:len(obj)-1]), "main.obj", DefaultPolicy)
+	if err == nil || !strings.Contains(err.Error(), "offset 0x0013: DATA record is truncated") {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestLoadBadLine(t *testing.T) {
+	clearMachine()
+	obj := objBytes(t, func(w *Writer) {
+		w.Code(0x0000, []uint16{0x9005, 0x103F})
+		w.File("main.asm")
+		w.Line(0x0000, 3, 0)
+		w.Line(0x0001, 4, 1)
+	})
+
+	_, err := Load(bytes.NewReader(obj), "main.obj", DefaultPolicy)
+	if err == nil || err.Error() != "offset 0x001E: line 4 at x0001 names file 1, but there are only 1 file names" {
+		t.Error("Unexpected error:", err)
+	}
+	if machine.Lc4.Mem[0x0001] != 0 || len(machine.Lc4.Files) != 0 {
+		t.Error("Object file loaded despite errors")
+	}
+
+	// unless it's ignored, when the line is skipped
+	warnings, err := Load(bytes.NewReader(obj), "main.obj", Policy{CHECK_LINE: IGNORE})
+	if err != nil || len(warnings) != 0 {
+		t.Fatal("Unexpected problems:", warnings, err)
+	}
+	if machine.Lc4.Meta[0x0000].Line != 3 || machine.Lc4.Meta[0x0001].Line != 0 {
+		t.Error("Unexpected lines", machine.Lc4.Meta[0x0000], machine.Lc4.Meta[0x0001])
+	}
+}
+
+func TestParse(t *testing.T) {
+	clearMachine()
+	obj := objBytes(t, func(w *Writer) {
+		w.Line(0x0001, 4, 0)
+		w.Code(0x0000, []uint16{0x9005, 0x103F})
+		w.Data(0x4000, []uint16{7})
+		w.Symbol(0x4000, "VALUE")
+		w.File("main.asm")
+		w.Reloc(0x0001, 1, 2, "PRINT")
+	})
+
+	prog, err := Parse(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.Segments) != 2 || prog.Segments[0].Data || !prog.Segments[1].Data ||
+		prog.Segments[1].Addr != 0x4000 || prog.Segments[1].Words[0] != 7 || prog.Segments[1].Offset != 18 {
+		t.Error("Unexpected segments", prog.Segments)
+	}
+	if prog.Symbols["VALUE"] != 0x4000 || len(prog.Files) != 1 || prog.Files[0] != "main.asm" {
+		t.Error("Unexpected symbols and files", prog.Symbols, prog.Files)
+	}
+	if len(prog.Lines) != 1 || prog.Lines[0] != (Line{Addr: 0x0001, Line: 4, FileIdx: 0, Offset: 0}) {
+		t.Error("Unexpected lines", prog.Lines)
+	}
+	if len(prog.Relocs) != 1 || prog.Relocs[0].Symbol != "PRINT" || prog.Relocs[0].Offset != 2 {
+		t.Error("Unexpected relocations", prog.Relocs)
+	}
+
+	// parsing doesn't touch the machine
+	if machine.Lc4.Mem[0x0000] != 0 || len(machine.Lc4.Labels) != 0 || len(machine.Lc4.Files) != 0 {
+		t.Error("Parse changed the machine")
+	}
+
+	if _, err := Parse(bytes.NewReader(obj[:5])); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+}
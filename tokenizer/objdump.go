@@ -0,0 +1,143 @@
+package tokenizer
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Objdump describes the contents of an object file: every record with its
+// offset, the symbol, file and line tables, a disassembly of each code block
+// and the size of each block. If the file is bad, the records before the
+// problem are described, and the error is returned.
+func Objdump(w io.Writer, r io.Reader) error {
+	records, readErr := ReadRecords(r)
+
+	var blocks []Record
+	var files []string
+	numSymbols := 0
+	symbols := map[uint16][]string{}
+	type line struct{ line, fileIdx uint16 }
+	lines := map[uint16]line{}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "; records")
+	fmt.Fprintln(tw, "Offset\tType\tAddr\tContents")
+	for _, rec := range records {
+		var addrs, contents string
+		switch rec.Header {
+		case CODE_HEADER, DATA_HEADER:
+			addrs = blockRange(rec)
+			contents = fmt.Sprintf("%d words", len(rec.Words))
+			blocks = append(blocks, rec)
+		case SYMBOL_HEADER:
+			addrs = fmt.Sprintf("x%04X", rec.Addr)
+			contents = rec.Name
+			symbols[rec.Addr] = append(symbols[rec.Addr], rec.Name)
+			numSymbols++
+		case FILE_HEADER:
+			contents = fmt.Sprintf("#%d %s", len(files), rec.Name)
+			files = append(files, rec.Name)
+		case LINE_HEADER:
+			addrs = fmt.Sprintf("x%04X", rec.Addr)
+			contents = fmt.Sprintf("line %d of file #%d", rec.Line, rec.FileIdx)
+			lines[rec.Addr] = line{rec.Line, rec.FileIdx}
+		case RELOC_HEADER:
+			addrs = fmt.Sprintf("x%04X", rec.Addr)
+			contents = fmt.Sprintf("kind %d, %s%+d", rec.Kind, rec.Name, rec.RelocOffset)
+		}
+		fmt.Fprintf(tw, "0x%04X\t%s\t%s\t%s\n", rec.Offset, HeaderName(rec.Header), addrs, contents)
+	}
+	tw.Flush()
+	if readErr != nil {
+		fmt.Fprintln(w, "; error:", readErr)
+	}
+
+	// a line's file, or its index if the file isn't in the table
+	source := func(l line) string {
+		if int(l.fileIdx) < len(files) {
+			return fmt.Sprintf("%s:%d", files[l.fileIdx], l.line)
+		}
+		return fmt.Sprintf("#%d:%d", l.fileIdx, l.line)
+	}
+
+	addrs := make([]int, 0, len(symbols))
+	for addr := range symbols {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+	fmt.Fprintln(w, "\n; symbols")
+	for _, addr := range addrs {
+		sort.Strings(symbols[uint16(addr)])
+		for _, name := range symbols[uint16(addr)] {
+			fmt.Fprintf(w, "x%04X  %s\n", addr, name)
+		}
+	}
+
+	fmt.Fprintln(w, "\n; files")
+	for i, name := range files {
+		fmt.Fprintf(w, "#%d  %s\n", i, name)
+	}
+
+	addrs = addrs[:0]
+	for addr := range lines {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+	fmt.Fprintln(w, "\n; lines")
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "x%04X  %s\n", addr, source(lines[uint16(addr)]))
+	}
+
+	for _, block := range blocks {
+		if block.Header != CODE_HEADER {
+			continue
+		}
+		fmt.Fprintf(w, "\n; code %s\n", blockRange(block))
+		for i, word := range block.Words {
+			addr := block.Addr + uint16(i)
+			for _, name := range symbols[addr] {
+				fmt.Fprintf(w, "%s:\n", name)
+			}
+
+			insn := machine.DecodeWord(word)
+			var target, src string
+			if addr, ok := insn.Target(addr); ok && len(symbols[addr]) > 0 {
+				target = "; " + symbols[addr][0]
+			}
+			if l, exists := lines[addr]; exists {
+				src = "; " + source(l)
+			}
+			text := fmt.Sprintf("  x%04X  %04X  %-20s  %-16s  %s", addr, word, insn.Asm(), target, src)
+			fmt.Fprintln(w, strings.TrimRight(text, " "))
+		}
+	}
+
+	fmt.Fprintln(w, "\n; sizes")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	total := map[uint16]int{}
+	for _, block := range blocks {
+		kind := "code"
+		if block.Header == DATA_HEADER {
+			kind = "data"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d words\t\n", kind, blockRange(block), len(block.Words))
+		total[block.Header] += len(block.Words)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "total: %d code words, %d data words, %d symbols\n",
+		total[CODE_HEADER], total[DATA_HEADER], numSymbols)
+
+	return readErr
+}
+
+// blockRange formats the addresses a block covers
+func blockRange(block Record) string {
+	if len(block.Words) == 0 {
+		return fmt.Sprintf("x%04X (empty)", block.Addr)
+	}
+	return fmt.Sprintf("x%04X-x%04X", block.Addr, uint16(int(block.Addr)+len(block.Words)-1))
+}
@@ -0,0 +1,115 @@
+package tokenizer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func objBytes(t *testing.T, write func(w *Writer)) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	write(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadRecords(t *testing.T) {
+	obj := objBytes(t, func(w *Writer) {
+		w.Code(0x0000, []uint16{0x9005, 0x103F})
+		w.Symbol(0x0000, "MAIN")
+		w.File("main.asm")
+		w.Line(0x0001, 4, 0)
+		w.Reloc(0x0001, 1, 0xFFFE, "PRINT")
+	})
+
+	records, err := ReadRecords(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expected 5 records, got %d", len(records))
+	}
+
+	offsets := []int64{0, 10, 20, 32, 40}
+	for i, rec := range records {
+		if rec.Offset != offsets[i] {
+			t.Errorf("Record %d is at offset %d, expected %d", i, rec.Offset, offsets[i])
+		}
+	}
+	if len(records[0].Words) != 2 || records[0].Words[1] != 0x103F {
+		t.Errorf("Code block read as %v", records[0].Words)
+	}
+	if records[1].Name != "MAIN" || records[2].Name != "main.asm" {
+		t.Errorf("Names read as %q and %q", records[1].Name, records[2].Name)
+	}
+	if records[3].Addr != 1 || records[3].Line != 4 || records[3].FileIdx != 0 {
+		t.Errorf("Line record read as %+v", records[3])
+	}
+	if records[4].Name != "PRINT" || records[4].Kind != 1 || records[4].RelocOffset != -2 {
+		t.Errorf("Relocation read as %+v", records[4])
+	}
+}
+
+func TestReadRecordsBadFile(t *testing.T) {
+	obj := objBytes(t, func(w *Writer) {
+		w.Symbol(0x0000, "MAIN")
+		w.Code(0x0000, []uint16{0x9005, 0x103F})
+	})
+
+	// the code block is missing its last word
+	records, err := ReadRecords(bytes.NewReader(obj[:len(obj)-2]))
+	var formatErr *FormatError
+	if !errors.As(err, &formatErr) {
+		t.Fatalf("Expected a FormatError, got %v", err)
+	}
+	if formatErr.Offset != 10 || !strings.Contains(formatErr.Msg, "CODE record is truncated") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Name != "MAIN" {
+		t.Errorf("Expected the symbol before the error, got %+v", records)
+	}
+
+	_, err = ReadRecords(bytes.NewReader(append(obj, 0x12, 0x34)))
+	if err == nil || err.Error() != "offset 0x0014: unknown record header x1234" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestObjdump(t *testing.T) {
+	obj := objBytes(t, func(w *Writer) {
+		w.Code(0x0000, []uint16{0x9005, 0x103F, 0x03FE})
+		w.Data(0x4000, []uint16{1, 2})
+		w.Symbol(0x0001, "LOOP")
+		w.File("main.asm")
+		w.Line(0x0002, 5, 0)
+	})
+
+	var out bytes.Buffer
+	if err := Objdump(&out, bytes.NewReader(obj)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"0x0000  CODE    x0000-x0002  3 words",
+		"0x000C  DATA    x4000-x4001  2 words",
+		"x0001  LOOP",
+		"#0  main.asm",
+		"x0002  main.asm:5",
+		"LOOP:\n  x0001  103F  ADD R0, R0, #-1\n",
+		"  x0002  03FE  BRp #-2               ; LOOP            ; main.asm:5\n",
+		"total: 3 code words, 2 data words, 1 symbols",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	err := Objdump(&out, bytes.NewReader(obj[:len(obj)-1]))
+	if err == nil || !strings.Contains(out.String(), "; error: offset 0x002C: LINE record is truncated") {
+		t.Errorf("Expected the truncated line record to be reported, got %v in:\n%s", err, out.String())
+	}
+}
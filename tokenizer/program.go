@@ -0,0 +1,136 @@
+package tokenizer
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// Program is the contents of an object file, which LoadProgram loads into the
+// machine. The assembler and linker build and write programs in this form.
+type Program struct {
+	Segments []*Segment
+	Symbols  map[string]uint16
+	Files    []string
+	Lines    []Line
+	Relocs   []Reloc
+}
+
+// Segment is a block of code or data loaded at Addr
+type Segment struct {
+	Data  bool
+	Addr  uint16
+	Words []uint16
+	// byte offset of the block's record in the file, or -1 for a program
+	// that wasn't read from one
+	Offset int64
+}
+
+// Line is the source line of the word at Addr, where FileIdx indexes the
+// program's Files
+type Line struct {
+	Addr    uint16
+	Line    uint16
+	FileIdx uint16
+	// byte offset of the line's record in the file, or -1
+	Offset int64
+}
+
+// Reloc is a reference from the word at Addr to Symbol+Offset in another
+// object file, which a linker fills in
+type Reloc struct {
+	Addr   uint16
+	Kind   uint16
+	Offset int16
+	Symbol string
+	// byte offset of the relocation's record in the file, or -1
+	RecordOffset int64
+}
+
+// relocation kinds, which say which bits of the word at Addr are filled in
+const (
+	// the whole word, for .FILL
+	RELOC_WORD = iota
+	// the IMM9 offset of a branch
+	RELOC_PC9
+	// the IMM11 offset of JMP
+	RELOC_PC11
+	// the IMM11 of JSR, which holds the target's address >> 4
+	RELOC_JSR
+	// the low byte of the address, for CONST
+	RELOC_LO8
+	// the high byte of the address, for HICONST
+	RELOC_HI8
+)
+
+// Parse reads an object file without loading it. The error is a
+// *FormatError for a truncated file or an unknown record.
+func Parse(r io.Reader) (*Program, error) {
+	records, err := ReadRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	prog := &Program{Symbols: map[string]uint16{}}
+	for _, rec := range records {
+		switch rec.Header {
+		case CODE_HEADER, DATA_HEADER:
+			prog.Segments = append(prog.Segments, &Segment{
+				Data:   rec.Header == DATA_HEADER,
+				Addr:   rec.Addr,
+				Words:  rec.Words,
+				Offset: rec.Offset,
+			})
+		case SYMBOL_HEADER:
+			prog.Symbols[rec.Name] = rec.Addr
+		case FILE_HEADER:
+			prog.Files = append(prog.Files, rec.Name)
+		case LINE_HEADER:
+			prog.Lines = append(prog.Lines, Line{Addr: rec.Addr, Line: rec.Line, FileIdx: rec.FileIdx, Offset: rec.Offset})
+		case RELOC_HEADER:
+			prog.Relocs = append(prog.Relocs, Reloc{
+				Addr:         rec.Addr,
+				Kind:         rec.Kind,
+				Offset:       rec.RelocOffset,
+				Symbol:       rec.Name,
+				RecordOffset: rec.Offset,
+			})
+		}
+	}
+	return prog, nil
+}
+
+// SymbolNames returns the program's symbols sorted by address, then name
+func (p *Program) SymbolNames() []string {
+	names := make([]string, 0, len(p.Symbols))
+	for name := range p.Symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.Symbols[names[i]] != p.Symbols[names[j]] {
+			return p.Symbols[names[i]] < p.Symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// LineAt returns the source line of the word at addr, if it has one
+func (p *Program) LineAt(addr uint16) (Line, bool) {
+	for _, line := range p.Lines {
+		if line.Addr == addr {
+			return line, true
+		}
+	}
+	return Line{}, false
+}
+
+// ParseFile reads an object file, see Parse
+func ParseFile(fileName string) (*Program, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
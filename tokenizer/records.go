@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Record is one record of an object file, as it was written
+type Record struct {
+	// byte offset of the record's header in the file
+	Offset int64
+	Header uint16
+	// address of a block, symbol, line or relocation
+	Addr  uint16
+	Words []uint16
+	// name of a symbol, file or relocation's symbol
+	Name    string
+	Line    uint16
+	FileIdx uint16
+	// kind and offset of a relocation
+	Kind        uint16
+	RelocOffset int16
+}
+
+// FormatError is a problem with an object file, at a byte offset into it
+type FormatError struct {
+	Offset int64
+	Msg    string
+}
+
+func (err *FormatError) Error() string {
+	return fmt.Sprintf("offset 0x%04X: %s", err.Offset, err.Msg)
+}
+
+// HeaderName returns the name of a record header, such as CODE
+func HeaderName(header uint16) string {
+	switch header {
+	case CODE_HEADER:
+		return "CODE"
+	case DATA_HEADER:
+		return "DATA"
+	case SYMBOL_HEADER:
+		return "SYMBOL"
+	case FILE_HEADER:
+		return "FILE"
+	case LINE_HEADER:
+		return "LINE"
+	case RELOC_HEADER:
+		return "RELOC"
+	}
+	return fmt.Sprintf("x%04X", header)
+}
+
+// recordReader reads the words of an object file, counting bytes read
+type recordReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+func (rr *recordReader) word() (uint16, error) {
+	var buf [2]byte
+	n, err := io.ReadFull(rr.r, buf[:])
+	rr.offset += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(buf[0])<<8 | uint16(buf[1]), nil
+}
+
+func (rr *recordReader) str() (string, error) {
+	n, err := rr.word()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(rr.r, buf)
+	rr.offset += int64(read)
+	return string(buf), err
+}
+
+// ReadRecords reads every record of an object file. On an error, the records
+// before it are returned along with a *FormatError, or the error from r.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	rr := &recordReader{r: bufio.NewReader(r)}
+	var records []Record
+	for {
+		rec := Record{Offset: rr.offset}
+		if _, err := rr.r.Peek(1); err == io.EOF {
+			return records, nil
+		}
+
+		err := rr.read(&rec)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return records, &FormatError{rec.Offset, fmt.Sprintf(
+				"%s record is truncated, the file ends at offset 0x%04X", HeaderName(rec.Header), rr.offset)}
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// read reads the record whose header is at the reader's offset into rec
+func (rr *recordReader) read(rec *Record) (err error) {
+	if rec.Header, err = rr.word(); err != nil {
+		return err
+	}
+
+	switch rec.Header {
+	case CODE_HEADER, DATA_HEADER:
+		if rec.Addr, err = rr.word(); err != nil {
+			return err
+		}
+		n, err := rr.word()
+		if err != nil {
+			return err
+		}
+		rec.Words = make([]uint16, n)
+		for i := range rec.Words {
+			if rec.Words[i], err = rr.word(); err != nil {
+				return err
+			}
+		}
+	case SYMBOL_HEADER:
+		if rec.Addr, err = rr.word(); err != nil {
+			return err
+		}
+		rec.Name, err = rr.str()
+	case FILE_HEADER:
+		rec.Name, err = rr.str()
+	case LINE_HEADER:
+		if rec.Addr, err = rr.word(); err != nil {
+			return err
+		}
+		if rec.Line, err = rr.word(); err != nil {
+			return err
+		}
+		rec.FileIdx, err = rr.word()
+	case RELOC_HEADER:
+		if rec.Addr, err = rr.word(); err != nil {
+			return err
+		}
+		if rec.Kind, err = rr.word(); err != nil {
+			return err
+		}
+		offset, err := rr.word()
+		if err != nil {
+			return err
+		}
+		rec.RelocOffset = int16(offset)
+		rec.Name, err = rr.str()
+		return err
+	default:
+		return &FormatError{rec.Offset, fmt.Sprintf("unknown record header x%04X", rec.Header)}
+	}
+	return err
+}
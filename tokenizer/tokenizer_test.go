@@ -1,16 +1,38 @@
 package tokenizer
 
 import (
+	"bytes"
 	"github.com/hryoma/lc4go/machine"
-	"github.com/hryoma/lc4go/tokenizer"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
-var test_folder string = "/../test_objs/"
+// writeObj writes an object file fixture to a temporary directory
+func writeObj(t *testing.T, name string, write func(w *Writer)) string {
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, objBytes(t, write), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func clearMachine() {
+	machine.Lc4.Mem = [machine.MEM_SIZE]uint16{}
+	machine.Lc4.Labels = map[string]uint16{}
+	machine.Lc4.Meta = map[uint16]machine.MemMetadata{}
+	machine.Lc4.Files = nil
+	machine.Lc4.Blocks = nil
+	machine.Lc4.LabelSources = nil
+	machine.Lc4.FileSources = nil
+}
 
 func TestTokenizeObjMultiplyObj(t *testing.T) {
-	var fileName = test_folder + "multiply.obj"
-	tokenizer.TokenizeObj(fileName)
+	clearMachine()
+	var fileName = writeObj(t, "multiply.obj", func(w *Writer) {
+		w.Code(0x0000, []uint16{0x9400, 0x2300, 0x0C03, 0x1480, 0x127F, 0x0FFB, 0x0000})
+	})
+	TokenizeObj(fileName)
 
 	if machine.Lc4.Mem[0] != 0x9400 {
 		t.Log("Data block not parsed correctly")
@@ -48,3 +70,78 @@ func TestTokenizeObjMultiplyObj(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestTokenizeObjRecords(t *testing.T) {
+	clearMachine()
+	machine.Lc4.Files = []string{"loaded.asm"}
+	fileName := writeObj(t, "records.obj", func(w *Writer) {
+		w.Code(0x0010, []uint16{0x1261, 0xC1C0})
+		w.Data(0x4000, []uint16{0x00AB})
+		w.Symbol(0x0010, "INC")
+		w.Symbol(0x4000, "VALUE")
+		w.File("inc.asm")
+		w.Line(0x0010, 3, 0)
+	})
+	TokenizeObj(fileName)
+
+	if machine.Lc4.Mem[0x0011] != 0xC1C0 || machine.Lc4.Mem[0x4000] != 0x00AB {
+		t.Errorf("Unexpected memory x%04X x%04X", machine.Lc4.Mem[0x0011], machine.Lc4.Mem[0x4000])
+	}
+	if machine.Lc4.Labels["INC"] != 0x0010 || machine.Lc4.Meta[0x4000].Label != "VALUE" {
+		t.Error("Unexpected labels", machine.Lc4.Labels)
+	}
+	// file indices are relative to the files loaded before
+	if meta := machine.Lc4.Meta[0x0010]; meta.Line != 3 || machine.Lc4.Files[meta.File] != "inc.asm" {
+		t.Error("Unexpected line info", meta, machine.Lc4.Files)
+	}
+}
+
+func TestWriteMemRoundTrip(t *testing.T) {
+	clearMachine()
+	machine.Lc4.Mem[0x1FFF] = 0x1234
+	machine.Lc4.Mem[0x2000] = 0x5678
+	machine.Lc4.Labels["LAST"] = 0x1FFF
+	machine.Lc4.Labels["OUTSIDE"] = 0x3000
+	machine.Lc4.Meta[0x1FFF] = machine.MemMetadata{Label: "LAST", Line: 7, File: 1}
+	machine.Lc4.Files = []string{"other.asm", "prog.asm"}
+
+	var buf bytes.Buffer
+	if err := WriteMem(&buf, 0x1FFF, 0x2000); err != nil {
+		t.Fatal(err)
+	}
+
+	// a code block, a data block, a symbol, a file and a line
+	expected := []byte{
+		0xCA, 0xDE, 0x1F, 0xFF, 0x00, 0x01, 0x12, 0x34,
+		0xDA, 0xDA, 0x20, 0x00, 0x00, 0x01, 0x56, 0x78,
+		0xC3, 0xB7, 0x1F, 0xFF, 0x00, 0x04, 'L', 'A', 'S', 'T',
+		0xF1, 0x7E, 0x00, 0x08, 'p', 'r', 'o', 'g', '.', 'a', 's', 'm',
+		0x71, 0x5E, 0x1F, 0xFF, 0x00, 0x07, 0x00, 0x00,
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected % X but got % X", expected, buf.Bytes())
+	}
+
+	fileName := writeObj(t, "dump.obj", func(w *Writer) {})
+	if err := WriteMemFile(fileName, 0x1FFF, 0x2000); err != nil {
+		t.Fatal(err)
+	}
+	clearMachine()
+	TokenizeObj(fileName)
+	if machine.Lc4.Mem[0x1FFF] != 0x1234 || machine.Lc4.Mem[0x2000] != 0x5678 || machine.Lc4.Labels["LAST"] != 0x1FFF {
+		t.Error("Memory did not round trip", machine.Lc4.Labels)
+	}
+	if meta := machine.Lc4.Meta[0x1FFF]; meta.Line != 7 || machine.Lc4.Files[meta.File] != "prog.asm" {
+		t.Error("Line info did not round trip", meta, machine.Lc4.Files)
+	}
+}
+
+func TestWriteBlockTooLong(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Code(0x0000, make([]uint16, MAX_BLOCK_SIZE+1))
+	err := w.Flush()
+	if err == nil || err.Error() != "block at x0000 is 65536 words long, but a record holds at most 65535" {
+		t.Error("Expected an error for a block that is too long but got", err)
+	}
+}
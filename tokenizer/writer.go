@@ -0,0 +1,189 @@
+package tokenizer
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hryoma/lc4go/machine"
+	"io"
+	"os"
+	"sort"
+)
+
+// object file record headers
+const (
+	CODE_HEADER   = 0xCADE
+	DATA_HEADER   = 0xDADA
+	SYMBOL_HEADER = 0xC3B7
+	FILE_HEADER   = 0xF17E
+	LINE_HEADER   = 0x715E
+	// a reference to a symbol in another object file, see recordReader.read
+	// and Writer.Reloc
+	RELOC_HEADER = 0x7E10
+)
+
+// the most words a code or data record can hold
+const MAX_BLOCK_SIZE = 0xFFFF
+
+// Writer writes the records of an object file, in the format TokenizeObj
+// reads. The first error stops any more writes, and is returned by Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) word(val uint16) {
+	if w.err == nil {
+		_, w.err = w.w.Write([]byte{byte(val >> 8), byte(val)})
+	}
+}
+
+func (w *Writer) str(val string) {
+	w.word(uint16(len(val)))
+	if w.err == nil {
+		_, w.err = w.w.WriteString(val)
+	}
+}
+
+func (w *Writer) block(header uint16, addr uint16, words []uint16) {
+	// the length is a single word
+	if len(words) > MAX_BLOCK_SIZE && w.err == nil {
+		w.err = fmt.Errorf("block at x%04X is %d words long, but a record holds at most %d", addr, len(words), MAX_BLOCK_SIZE)
+	}
+	w.word(header)
+	w.word(addr)
+	w.word(uint16(len(words)))
+	for _, val := range words {
+		w.word(val)
+	}
+}
+
+// Code writes a block of code loaded at addr
+func (w *Writer) Code(addr uint16, words []uint16) {
+	w.block(CODE_HEADER, addr, words)
+}
+
+// Data writes a block of data loaded at addr
+func (w *Writer) Data(addr uint16, words []uint16) {
+	w.block(DATA_HEADER, addr, words)
+}
+
+// Symbol writes a label
+func (w *Writer) Symbol(addr uint16, name string) {
+	w.word(SYMBOL_HEADER)
+	w.word(addr)
+	w.str(name)
+}
+
+// File writes a source file name. Line records refer to files by the order
+// they are written in, starting at 0.
+func (w *Writer) File(name string) {
+	w.word(FILE_HEADER)
+	w.str(name)
+}
+
+// Line writes the source line of the word at addr
+func (w *Writer) Line(addr uint16, line uint16, fileIdx uint16) {
+	w.word(LINE_HEADER)
+	w.word(addr)
+	w.word(line)
+	w.word(fileIdx)
+}
+
+// Reloc writes a reference from the word at addr to a symbol in another
+// object file, which a linker fills in
+func (w *Writer) Reloc(addr uint16, kind uint16, offset uint16, symbol string) {
+	w.word(RELOC_HEADER)
+	w.word(addr)
+	w.word(kind)
+	w.word(offset)
+	w.str(symbol)
+}
+
+// Flush writes any buffered records, and returns the first error
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// isData reports whether addr is in one of the data regions of memory
+func isData(addr int) bool {
+	return (machine.USER_DATA_START <= addr && addr <= machine.USER_DATA_END) || machine.OS_DATA_START <= addr
+}
+
+// WriteMem writes the machine's memory from start to end, inclusive, as an
+// object file, along with the labels, file names and line numbers of those
+// addresses. The range is split into code and data blocks by region.
+func WriteMem(w io.Writer, start uint16, end uint16) error {
+	ow := NewWriter(w)
+
+	for addr := int(start); addr <= int(end); {
+		blockStart := addr
+		data := isData(addr)
+		for addr <= int(end) && isData(addr) == data {
+			addr++
+		}
+
+		words := machine.Lc4.Mem[blockStart:addr]
+		if data {
+			ow.Data(uint16(blockStart), words)
+		} else {
+			ow.Code(uint16(blockStart), words)
+		}
+	}
+
+	labels := make([]string, 0, len(machine.Lc4.Labels))
+	for label, addr := range machine.Lc4.Labels {
+		if start <= addr && addr <= end {
+			labels = append(labels, label)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if machine.Lc4.Labels[labels[i]] != machine.Lc4.Labels[labels[j]] {
+			return machine.Lc4.Labels[labels[i]] < machine.Lc4.Labels[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	for _, label := range labels {
+		ow.Symbol(machine.Lc4.Labels[label], label)
+	}
+
+	// only the files that lines in the range refer to are written, so their
+	// indices are renumbered
+	fileIdxs := map[int]uint16{}
+	for addr := int(start); addr <= int(end); addr++ {
+		meta, exists := machine.Lc4.Meta[uint16(addr)]
+		if !exists || meta.Line == 0 || meta.File < 0 || meta.File >= len(machine.Lc4.Files) {
+			continue
+		}
+		fileIdx, written := fileIdxs[meta.File]
+		if !written {
+			fileIdx = uint16(len(fileIdxs))
+			fileIdxs[meta.File] = fileIdx
+			ow.File(machine.Lc4.Files[meta.File])
+		}
+		ow.Line(uint16(addr), meta.Line, fileIdx)
+	}
+
+	return ow.Flush()
+}
+
+// WriteMemFile writes the machine's memory from start to end to an object
+// file, see WriteMem
+func WriteMemFile(fileName string, start uint16, end uint16) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteMem(file, start, end); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
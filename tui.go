@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/tui"
+	"io"
+	"os"
+	"strings"
+)
+
+const DEFAULT_WIDTH = 80
+const DEFAULT_HEIGHT = 24
+
+// runTui is a full screen alternative to runShell, which redraws the machine
+// after every command and shows the command's output below it
+func runTui(readRc bool, scripts []string) {
+	fd := int(os.Stdout.Fd())
+	if !readline.IsTerminal(fd) {
+		fmt.Println("The TUI needs a terminal")
+		return
+	}
+
+	screen := tui.NewScreen(DEFAULT_WIDTH, DEFAULT_HEIGHT)
+	draw := func() {
+		if width, height, err := readline.GetSize(fd); err == nil {
+			screen.Width, screen.Height = width, height
+		}
+		fmt.Print(screen.Render())
+	}
+
+	screen.AddOutput(captureOutput(func() {
+		startup(readRc, scripts)
+	}))
+
+	shell := newShell()
+	defer shell.Close()
+
+	fmt.Print(tui.ENTER_ALT)
+	defer fmt.Print(tui.EXIT_ALT)
+
+	draw()
+	readCommands(shell, func(args []string) {
+		screen.AddOutput("lc4> " + strings.Join(args, " "))
+		if args[0] == "memory" {
+			// memory <addr> moves the memory pane
+			if addr, err := emulator.Eval(strings.Join(args[1:], " ")); err == nil {
+				screen.MemAddr = addr
+			} else {
+				screen.AddOutput(fmt.Sprint("Invalid address: ", err))
+			}
+		} else {
+			screen.Snapshot()
+			screen.AddOutput(captureOutput(func() {
+				runArgs(args)
+			}))
+		}
+		draw()
+	})
+}
+
+// captureOutput returns everything run prints
+func captureOutput(run func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		run()
+		return ""
+	}
+
+	// buffered so the reader can finish even if run panics
+	output := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		output <- string(data)
+	}()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = writer, writer
+	func() {
+		defer func() {
+			os.Stdout, os.Stderr = stdout, stderr
+			writer.Close()
+		}()
+		run()
+	}()
+	return <-output
+}
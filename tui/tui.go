@@ -0,0 +1,231 @@
+// Package tui renders a full screen view of the LC4 machine for terminals:
+// the registers and PSR, the disassembly around the pc, a memory view and the
+// output of recent commands. Values that changed since the last snapshot are
+// highlighted.
+package tui
+
+import (
+	"fmt"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"strings"
+)
+
+// ANSI escape sequences
+const (
+	CLEAR_SCREEN = "\x1b[H\x1b[2J"
+	ENTER_ALT    = "\x1b[?1049h"
+	EXIT_ALT     = "\x1b[?1049l"
+	RESET        = "\x1b[0m"
+	BOLD         = "\x1b[1m"
+	CHANGED      = "\x1b[1;33m"
+	CURRENT      = "\x1b[7m"
+	BREAKPOINT   = "\x1b[31m"
+)
+
+const REGS_WIDTH = 22
+const CODE_BEFORE_PC = 3
+const MEM_ROWS = 4
+const MAX_MEM_COLS = 8
+const MAX_OUTPUT_LINES = 1000
+
+// the rows used by everything but the output pane: the title, the register
+// and code panes, the memory title and pane, the output title and the prompt
+const REGS_ROWS = machine.NUM_REGS + 3
+const FIXED_ROWS = 1 + REGS_ROWS + 1 + MEM_ROWS + 1 + 1
+
+type snapshot struct {
+	reg [machine.NUM_REGS]uint16
+	pc  uint16
+	psr uint16
+	mem [machine.MEM_SIZE]uint16
+}
+
+type Screen struct {
+	Width  int
+	Height int
+	// the first address of the memory pane
+	MemAddr uint16
+
+	prev   *snapshot
+	output []string
+}
+
+func NewScreen(width int, height int) *Screen {
+	return &Screen{Width: width, Height: height, MemAddr: 0x4000}
+}
+
+// Snapshot remembers the machine, so that the next render highlights
+// everything that changes after it
+func (s *Screen) Snapshot() {
+	s.prev = &snapshot{
+		reg: machine.Lc4.Reg,
+		pc:  machine.Lc4.Pc,
+		psr: machine.Lc4.Psr,
+		mem: machine.Lc4.Mem,
+	}
+}
+
+// AddOutput appends command output to the output pane
+func (s *Screen) AddOutput(text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+
+	s.output = append(s.output, strings.Split(text, "\n")...)
+	if len(s.output) > MAX_OUTPUT_LINES {
+		s.output = s.output[len(s.output)-MAX_OUTPUT_LINES:]
+	}
+}
+
+// Render draws the whole screen, leaving the cursor on the last line for the
+// prompt
+func (s *Screen) Render() string {
+	var b strings.Builder
+	b.WriteString(CLEAR_SCREEN)
+
+	s.title(&b, " lc4go ")
+	regs := s.registers()
+	code := s.code(REGS_ROWS)
+	for i := 0; i < REGS_ROWS; i++ {
+		b.WriteString(regs[i])
+		b.WriteString(" | ")
+		b.WriteString(code[i])
+		b.WriteString("\n")
+	}
+
+	s.title(&b, fmt.Sprintf(" Memory at 0x%04X ", s.MemAddr))
+	for _, line := range s.memory() {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	s.title(&b, " Output ")
+	outputRows := s.Height - FIXED_ROWS
+	if outputRows < 1 {
+		outputRows = 1
+	}
+	start := len(s.output) - outputRows
+	for i := start; i < len(s.output); i++ {
+		if i >= 0 {
+			b.WriteString(truncate(s.output[i], s.Width))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (s *Screen) title(b *strings.Builder, text string) {
+	line := "--" + text + strings.Repeat("-", atLeast(0, s.Width-len(text)-2))
+	b.WriteString(BOLD + truncate(line, s.Width) + RESET + "\n")
+}
+
+// highlight formats a value, highlighting it if it changed
+func highlight(text string, changed bool) string {
+	if changed {
+		return CHANGED + text + RESET
+	}
+	return text
+}
+
+func (s *Screen) registers() []string {
+	lines := []string{}
+	// each line is padded to REGS_WIDTH, not counting escape sequences
+	reg := func(name string, val uint16, changed bool) {
+		hex := highlight(fmt.Sprintf("0x%04X", val), changed)
+		line := fmt.Sprintf("%-3s %s %7d", name, hex, int16(val))
+		lines = append(lines, line+strings.Repeat(" ", REGS_WIDTH-18))
+	}
+
+	for i, val := range machine.Lc4.Reg {
+		reg(fmt.Sprintf("R%d", i), val, s.prev != nil && s.prev.reg[i] != val)
+	}
+	reg("PC", machine.Lc4.Pc, s.prev != nil && s.prev.pc != machine.Lc4.Pc)
+	psr := machine.Lc4.Psr
+	reg("PSR", psr, s.prev != nil && s.prev.psr != psr)
+
+	mode := "user"
+	if psr&0x8000 != 0 {
+		mode = "OS"
+	}
+	nzp := highlight(fmt.Sprintf("%d%d%d", psr>>2&1, psr>>1&1, psr&1), s.prev != nil && s.prev.psr&7 != psr&7)
+	line := fmt.Sprintf("NZP %s %10s", nzp, mode)
+	lines = append(lines, line+strings.Repeat(" ", REGS_WIDTH-18))
+	return lines
+}
+
+// code disassembles rows instructions, starting a few before the pc
+func (s *Screen) code(rows int) []string {
+	breakpoints := map[uint16]bool{}
+	for _, bp := range emulator.Breakpoints() {
+		if bp.Enabled && !bp.Dprintf {
+			breakpoints[bp.Addr] = true
+		}
+	}
+
+	width := s.Width - REGS_WIDTH - 3
+	lines := []string{}
+	addr := machine.Lc4.Pc - CODE_BEFORE_PC
+	for i := 0; i < rows; i++ {
+		marker := "  "
+		if breakpoints[addr] {
+			marker = BREAKPOINT + "*" + RESET + " "
+		}
+
+		text := fmt.Sprintf("0x%04X  %-12s %s", addr, label(addr), machine.Decode(addr).Asm())
+		text = truncate(text, width-2)
+		if addr == machine.Lc4.Pc {
+			text = CURRENT + text + strings.Repeat(" ", atLeast(0, width-2-len(text))) + RESET
+		}
+		lines = append(lines, marker+text)
+		addr++
+	}
+	return lines
+}
+
+func label(addr uint16) string {
+	if meta := machine.Lc4.Meta[addr]; meta.Label != "" {
+		return meta.Label + ":"
+	}
+	return ""
+}
+
+func (s *Screen) memory() []string {
+	cols := (s.Width - 8) / 7
+	if cols > MAX_MEM_COLS {
+		cols = MAX_MEM_COLS
+	} else if cols < 1 {
+		cols = 1
+	}
+
+	lines := []string{}
+	addr := s.MemAddr
+	for row := 0; row < MEM_ROWS; row++ {
+		line := fmt.Sprintf("0x%04X:", addr)
+		for col := 0; col < cols; col++ {
+			val := machine.Lc4.Mem[addr]
+			line += " " + highlight(fmt.Sprintf("0x%04X", val), s.prev != nil && s.prev.mem[addr] != val)
+			addr++
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncate cuts plain text to width columns
+func truncate(text string, width int) string {
+	if width < 0 {
+		return ""
+	} else if len(text) > width {
+		return text[:width]
+	}
+	return text
+}
+
+func atLeast(min int, val int) int {
+	if val < min {
+		return min
+	}
+	return val
+}
@@ -0,0 +1,52 @@
+package tui
+
+import (
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"strings"
+	"testing"
+)
+
+func TestRenderHighlightsChanges(t *testing.T) {
+	emulator.Clear()
+	machine.Lc4.Mem[0x8200] = 0x9005 // CONST R0, #5
+	machine.Lc4.Meta[0x8200] = machine.MemMetadata{Label: "START"}
+
+	screen := NewScreen(80, 24)
+	screen.Snapshot()
+	emulator.Exec()
+	screen.AddOutput("one\ntwo\n")
+	lines := strings.Split(screen.Render(), "\n")
+
+	if len(lines) != 24 {
+		t.Error("Expected 24 lines but got", len(lines))
+	}
+	if !strings.Contains(lines[1], "R0  "+CHANGED+"0x0005"+RESET) {
+		t.Errorf("Expected R0 to be highlighted but got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "R1  0x0000") {
+		t.Errorf("Expected R1 not to be highlighted but got %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "START:") || !strings.Contains(lines[3], "CONST R0, #5") {
+		t.Errorf("Expected START before the pc but got %q", lines[3])
+	}
+	if !strings.Contains(lines[4], CURRENT+"0x8201") {
+		t.Errorf("Expected the pc to be marked but got %q", lines[4])
+	}
+	if lines[21] != "one" || lines[22] != "two" {
+		t.Error("Expected the output at the bottom but got", lines[21:])
+	}
+}
+
+func TestRenderMarksBreakpoints(t *testing.T) {
+	emulator.Clear()
+	emulator.AddBreakpoint(0x8201, false)
+
+	lines := strings.Split(NewScreen(80, 24).Render(), "\n")
+	if !strings.Contains(lines[5], BREAKPOINT+"*"+RESET+" 0x8201") {
+		t.Errorf("Expected a breakpoint marker but got %q", lines[5])
+	}
+	if strings.Contains(lines[4], BREAKPOINT) {
+		t.Errorf("Expected no breakpoint marker but got %q", lines[4])
+	}
+}
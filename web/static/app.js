@@ -0,0 +1,235 @@
+"use strict";
+
+let nextId = 1;
+let running = false;
+let refreshing = false;
+let refreshAgain = false;
+let lastRegisters = null;
+let lastMemory = null;
+
+// rpc calls a JSON-RPC method and returns its result
+async function rpc(method, params) {
+  const resp = await fetch("rpc", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ jsonrpc: "2.0", id: nextId++, method, params }),
+  });
+  const msg = await resp.json();
+  if (msg.error) {
+    throw new Error(msg.error.message);
+  }
+  return msg.result;
+}
+
+function hex(val) {
+  return "0x" + val.toString(16).toUpperCase().padStart(4, "0");
+}
+
+function signed(val) {
+  return val >= 0x8000 ? val - 0x10000 : val;
+}
+
+function setStatus(text, isError) {
+  const status = document.getElementById("status");
+  status.textContent = text;
+  status.className = isError ? "error" : "";
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+async function refresh() {
+  // coalesce the notifications that arrive while refreshing
+  if (refreshing) {
+    refreshAgain = true;
+    return;
+  }
+  refreshing = true;
+  try {
+    const regs = await rpc("readRegisters");
+    showRegisters(regs);
+    await showCode(regs.pc);
+    await showBacktrace();
+    await showMemory();
+    document.getElementById("video").src = "framebuffer.png?" + Date.now();
+  } catch (err) {
+    setStatus(err.message, true);
+  } finally {
+    refreshing = false;
+  }
+  if (refreshAgain) {
+    refreshAgain = false;
+    refresh();
+  }
+}
+
+function showRegisters(regs) {
+  const table = document.getElementById("registers");
+  table.innerHTML = "";
+
+  const rows = regs.reg.map((val, i) => ["R" + i, val]);
+  rows.push(["PC", regs.pc], ["PSR", regs.psr]);
+  const last = lastRegisters ? lastRegisters.reg.concat([lastRegisters.pc, lastRegisters.psr]) : null;
+  rows.forEach(([name, val], i) => {
+    const row = table.insertRow();
+    const changed = last && last[i] !== val ? "changed" : "";
+    cell(row, name);
+    cell(row, hex(val), changed);
+    cell(row, signed(val), changed);
+  });
+
+  const row = table.insertRow();
+  cell(row, "NZP");
+  cell(row, [regs.n, regs.z, regs.p].map(bit => (bit ? "1" : "0")).join(""));
+  cell(row, regs.privilege ? "OS" : "user");
+
+  lastRegisters = regs;
+}
+
+async function showCode(pc) {
+  const start = Math.max(0, pc - 8);
+  const [insns, breakpoints] = await Promise.all([
+    rpc("disassemble", { addr: start, count: 24 }),
+    rpc("listBreakpoints"),
+  ]);
+  const bpAddrs = new Map(breakpoints.map(bp => [bp.addr, bp]));
+
+  const table = document.getElementById("code");
+  table.innerHTML = "";
+  for (const insn of insns) {
+    const row = table.insertRow();
+    const classes = [];
+    if (insn.addr === pc) {
+      classes.push("pc");
+    }
+    if (bpAddrs.has(insn.addr) && bpAddrs.get(insn.addr).enabled) {
+      classes.push("breakpoint");
+    }
+    row.className = classes.join(" ");
+
+    cell(row, hex(insn.addr));
+    cell(row, insn.label ? insn.label + ":" : "", "label");
+    cell(row, insn.asm);
+    cell(row, insn.line ? insn.file + ":" + insn.line : "", "line");
+    row.onclick = () => toggleBreakpoint(insn.addr, bpAddrs.get(insn.addr));
+  }
+}
+
+async function toggleBreakpoint(addr, bp) {
+  try {
+    if (bp) {
+      await rpc("deleteBreakpoint", { num: bp.num });
+    } else {
+      await rpc("setBreakpoint", { addr });
+    }
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+}
+
+async function showBacktrace() {
+  const frames = await rpc("backtrace");
+  const list = document.getElementById("backtrace");
+  list.innerHTML = "";
+  for (const frame of frames) {
+    const item = document.createElement("li");
+    item.textContent = hex(frame.pc) + " in " + frame.function;
+    list.appendChild(item);
+  }
+}
+
+async function showMemory() {
+  const addr = document.getElementById("memory-addr").value;
+  const mem = await rpc("readMemory", { addr, count: 128 });
+
+  const table = document.getElementById("memory");
+  table.innerHTML = "";
+  let row;
+  mem.values.forEach((val, i) => {
+    if (i % 8 === 0) {
+      row = table.insertRow();
+      cell(row, hex((mem.addr + i) & 0xffff) + ":");
+    }
+    const changed = lastMemory && lastMemory.addr === mem.addr && lastMemory.values[i] !== val;
+    cell(row, hex(val), changed ? "changed" : "");
+  });
+  lastMemory = mem;
+}
+
+function describeStop(stop) {
+  switch (stop.reason) {
+    case "breakpoint":
+      return "Hit breakpoint " + stop.breakpoint + " at " + hex(stop.pc);
+    case "halted":
+      return "Program halted";
+    case "error":
+      return "Execution error at " + hex(stop.pc);
+    case "limit":
+      return "Paused at " + hex(stop.pc);
+  }
+  return "Stopped at " + hex(stop.pc);
+}
+
+async function command(method, params) {
+  try {
+    const result = await rpc(method, params);
+    if (result && result.reason) {
+      setStatus(describeStop(result), result.reason === "error");
+    }
+    return result;
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+}
+
+// run continues in slices, so that the page can pause it and other pages see
+// its progress
+async function run() {
+  running = true;
+  setRunning(true);
+  setStatus("Running...");
+  let stop;
+  do {
+    stop = await command("continue", { maxSteps: 20000 });
+  } while (running && stop && stop.reason === "limit");
+  running = false;
+  setRunning(false);
+}
+
+function setRunning(isRunning) {
+  for (const button of document.querySelectorAll("nav button")) {
+    button.disabled = button.id === "pause" ? !isRunning : isRunning;
+  }
+}
+
+document.getElementById("load").onsubmit = async event => {
+  event.preventDefault();
+  const files = document.getElementById("files").value.split(/[\s,]+/).filter(name => name);
+  await command("clear");
+  if (await command("load", { files })) {
+    setStatus("Loaded " + files.join(", "));
+  }
+};
+
+document.getElementById("memory-form").onsubmit = event => {
+  event.preventDefault();
+  lastMemory = null;
+  refresh();
+};
+
+document.getElementById("reset").onclick = () => command("reset");
+document.getElementById("step").onclick = () => command("step");
+document.getElementById("next").onclick = () => command("next");
+document.getElementById("finish").onclick = () => command("finish");
+document.getElementById("continue").onclick = run;
+document.getElementById("pause").onclick = () => {
+  running = false;
+};
+
+new EventSource("events").addEventListener("change", refresh);
@@ -0,0 +1,221 @@
+// Package web serves a browser debugger for the LC4 machine. Its assets are
+// embedded in the binary, so it works without network access.
+//
+// The page drives the machine through the JSON-RPC methods of package
+// jsonrpc, POSTed one per request to /rpc, and every open page is told to
+// refresh over server-sent events from /events whenever one of them changes
+// the machine. The video memory is served as a PNG from /framebuffer.png.
+package web
+
+import (
+	"embed"
+	"fmt"
+	"github.com/hryoma/lc4go/jsonrpc"
+	"github.com/hryoma/lc4go/machine"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// the video display is 128x124 pixels in RGB555, one word per pixel
+const VIDEO_ADDR = 0xC000
+const VIDEO_COLS = 128
+const VIDEO_ROWS = 124
+
+const MAX_REQUEST_SIZE = 1 << 20
+
+//go:embed static
+var static embed.FS
+
+type Server struct {
+	// the machine is shared by every page
+	lock sync.Mutex
+
+	clientLock sync.Mutex
+	clients    map[chan struct{}]bool
+
+	// the Host headers the server answers to
+	hosts map[string]bool
+}
+
+func ListenAndServe(addr string) error {
+	fmt.Printf("Serving the debugger on http://%s\n", addr)
+	return http.ListenAndServe(addr, NewServer(addr))
+}
+
+// NewServer makes a server for the given listen address. It only answers
+// requests for that address, or for the loopback names on its port, or for
+// the machine's own addresses if it listens on all of them.
+func NewServer(addr string) *Server {
+	s := &Server{
+		clients: map[chan struct{}]bool{},
+		hosts:   map[string]bool{strings.ToLower(addr): true},
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return s
+	}
+	for _, name := range []string{"localhost", "127.0.0.1", "::1"} {
+		s.hosts[net.JoinHostPort(name, port)] = true
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		ifaceAddrs, _ := net.InterfaceAddrs()
+		for _, ifaceAddr := range ifaceAddrs {
+			if ipNet, ok := ifaceAddr.(*net.IPNet); ok {
+				s.hosts[net.JoinHostPort(ipNet.IP.String(), port)] = true
+			}
+		}
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// a page on another site can rebind its own name to this machine, so
+	// both its Host and its Origin look like ours; only known names are
+	// answered
+	if !s.hosts[strings.ToLower(r.Host)] {
+		http.Error(w, "Unknown host", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/rpc":
+		s.serveRpc(w, r)
+	case "/events":
+		s.serveEvents(w, r)
+	case "/framebuffer.png":
+		s.serveFramebuffer(w, r)
+	default:
+		assets, _ := fs.Sub(static, "static")
+		http.FileServer(http.FS(assets)).ServeHTTP(w, r)
+	}
+}
+
+func (s *Server) serveRpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON-RPC request", http.StatusMethodNotAllowed)
+		return
+	}
+	// another site's page can POST here too, so only take requests from our
+	// own pages, in a form a plain HTML form can't send
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "POST the request as application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MAX_REQUEST_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	resp := jsonrpc.Handle(data)
+	s.lock.Unlock()
+	s.notify()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// sameOrigin reports whether a request came from a page served by this
+// server. Requests without an Origin don't come from a browser page.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// notify tells every page that the machine may have changed
+func (s *Server) notify() {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+
+	for client := range s.clients {
+		// a page that hasn't caught up yet will refresh anyway
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan struct{}, 1)
+	s.clientLock.Lock()
+	s.clients[client] = true
+	s.clientLock.Unlock()
+	defer func() {
+		s.clientLock.Lock()
+		delete(s.clients, client)
+		s.clientLock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		fmt.Fprint(w, "event: change\ndata: {}\n\n")
+		flusher.Flush()
+
+		select {
+		case <-client:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) serveFramebuffer(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	img := Framebuffer()
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	png.Encode(w, img)
+}
+
+// Framebuffer renders the video memory
+func Framebuffer() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, VIDEO_COLS, VIDEO_ROWS))
+	for row := 0; row < VIDEO_ROWS; row++ {
+		for col := 0; col < VIDEO_COLS; col++ {
+			pixel := machine.Lc4.Mem[VIDEO_ADDR+row*VIDEO_COLS+col]
+			img.Set(col, row, color.RGBA{
+				R: scale5(pixel >> 10),
+				G: scale5(pixel >> 5),
+				B: scale5(pixel),
+				A: 0xFF,
+			})
+		}
+	}
+	return img
+}
+
+// scale5 widens the low 5 bits of a color channel to 8 bits
+func scale5(channel uint16) uint8 {
+	channel &= 0x1F
+	return uint8(channel<<3 | channel>>2)
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"bufio"
+	"github.com/hryoma/lc4go/emulator"
+	"github.com/hryoma/lc4go/machine"
+	"image/color"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves on a loopback port, with a server that knows that port
+func newTestServer() *httptest.Server {
+	server := httptest.NewUnstartedServer(nil)
+	server.Config.Handler = NewServer(server.Listener.Addr().String())
+	server.Start()
+	return server
+}
+
+func TestAssets(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	for _, path := range []string{"/", "/app.js", "/style.css"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Error("Expected", path, "to be served but got", resp.Status)
+		}
+	}
+}
+
+func TestRpcNotifiesPages(t *testing.T) {
+	emulator.Clear()
+	server := newTestServer()
+	defer server.Close()
+
+	events, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	reader := bufio.NewReader(events.Body)
+	expectEvent(t, reader)
+
+	resp, err := http.Post(server.URL+"/rpc", "application/json", strings.NewReader(
+		`{"jsonrpc": "2.0", "id": 1, "method": "writeRegister", "params": {"name": "R3", "value": 7}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"reg":[0,0,0,7,`) {
+		t.Error("Unexpected response", string(body))
+	}
+
+	expectEvent(t, reader)
+}
+
+func TestRpcRejectsOtherSites(t *testing.T) {
+	emulator.Clear()
+	server := newTestServer()
+	defer server.Close()
+
+	const body = `{"jsonrpc": "2.0", "id": 1, "method": "writeRegister", "params": {"name": "R3", "value": 7}}`
+	tests := []struct {
+		origin      string
+		contentType string
+		status      int
+	}{
+		{"", "application/json", http.StatusOK},
+		{server.URL, "application/json; charset=utf-8", http.StatusOK},
+		{"http://evil.example", "application/json", http.StatusForbidden},
+		{"null", "application/json", http.StatusForbidden},
+		{server.URL, "text/plain", http.StatusUnsupportedMediaType},
+		{"", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/rpc", strings.NewReader(body))
+		req.Header.Set("Content-Type", test.contentType)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Expected %d from origin %q with %q but got %s", test.status, test.origin, test.contentType, resp.Status)
+		}
+	}
+}
+
+func TestRejectsRebinding(t *testing.T) {
+	emulator.Clear()
+	server := newTestServer()
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	const body = `{"jsonrpc": "2.0", "id": 1, "method": "writeRegister", "params": {"name": "R3", "value": 7}}`
+	tests := []struct {
+		host   string
+		status int
+	}{
+		{"localhost:" + port, http.StatusOK},
+		{"LocalHost:" + port, http.StatusOK},
+		{"[::1]:" + port, http.StatusOK},
+		// evil.example resolves to this machine, so the page's Origin and
+		// the request's Host agree
+		{"evil.example:" + port, http.StatusForbidden},
+		{"localhost:1", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/rpc", strings.NewReader(body))
+		req.Host = test.host
+		req.Header.Set("Origin", "http://"+test.host)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Expected %d for host %q but got %s", test.status, test.host, resp.Status)
+		}
+	}
+	if machine.Lc4.Reg[3] != 7 {
+		t.Error("Expected the allowed requests to write R3 but got", machine.Lc4.Reg[3])
+	}
+}
+
+func expectEvent(t *testing.T, reader *bufio.Reader) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "event: change\n" {
+		t.Errorf("Expected a change event but got %q", line)
+	}
+	reader.ReadString('\n')
+	reader.ReadString('\n')
+}
+
+func TestFramebuffer(t *testing.T) {
+	emulator.Clear()
+	// red, then white, at the start of the second row
+	machine.Lc4.Mem[VIDEO_ADDR+VIDEO_COLS] = 0x7C00
+	machine.Lc4.Mem[VIDEO_ADDR+VIDEO_COLS+1] = 0x7FFF
+
+	server := newTestServer()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/framebuffer.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != VIDEO_COLS || size.Y != VIDEO_ROWS {
+		t.Error("Expected a 128x124 image but got", size)
+	}
+
+	expected := map[[2]int]color.RGBA{
+		{0, 0}: {0, 0, 0, 0xFF},
+		{0, 1}: {0xFF, 0, 0, 0xFF},
+		{1, 1}: {0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	for pos, c := range expected {
+		if actual := color.RGBAModel.Convert(img.At(pos[0], pos[1])); actual != c {
+			t.Error("Expected", c, "at", pos, "but got", actual)
+		}
+	}
+}